@@ -2,6 +2,7 @@ package ast
 
 import (
 	"bytes"
+	"math/big"
 	"strings"
 
 	"github.com/abs-lang/abs/token"
@@ -46,6 +47,26 @@ type Deferred struct {
 func (d *Deferred) IsDeferred() bool          { return d.deferred }
 func (d *Deferred) SetDeferred(deferred bool) { d.deferred = deferred }
 
+// Spannable is used to know where
+// a statement begins and ends in the
+// source code, so that it can be quoted
+// as it was written (eg. when tracing)
+type Spannable interface {
+	Span() (int, int)
+	SetSpan(begin int, end int)
+}
+
+// Spanned is a struct that can be embedded
+// in statements to remember the positions
+// they begin and end at in the source code.
+type Spanned struct {
+	begin int
+	end   int
+}
+
+func (s *Spanned) Span() (int, int)           { return s.begin, s.end }
+func (s *Spanned) SetSpan(begin int, end int) { s.begin, s.end = begin, end }
+
 // Represents the whole program
 // as a bunch of statements
 type Program struct {
@@ -72,6 +93,7 @@ func (p *Program) String() string {
 
 // Statements
 type AssignStatement struct {
+	Spanned
 	Token    token.Token // the token.ASSIGN token
 	Name     *Identifier
 	Names    []Expression
@@ -131,6 +153,7 @@ func (cs *ContinueStatement) String() string {
 }
 
 type ReturnStatement struct {
+	Spanned
 	Token       token.Token // the 'return' token
 	ReturnValue Expression
 }
@@ -151,7 +174,30 @@ func (rs *ReturnStatement) String() string {
 	return out.String()
 }
 
+type ThrowStatement struct {
+	Spanned
+	Token token.Token // the 'throw' token
+	Value Expression
+}
+
+func (ts *ThrowStatement) statementNode()       {}
+func (ts *ThrowStatement) TokenLiteral() string { return ts.Token.Literal }
+func (ts *ThrowStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(ts.TokenLiteral() + " ")
+
+	if ts.Value != nil {
+		out.WriteString(ts.Value.String())
+	}
+
+	out.WriteString(";")
+
+	return out.String()
+}
+
 type ExpressionStatement struct {
+	Spanned
 	Token      token.Token // the first token of the expression
 	Expression Expression
 }
@@ -223,6 +269,9 @@ func (b *Boolean) String() string       { return b.Token.Literal }
 type NumberLiteral struct {
 	Token token.Token
 	Value float64
+	// Integers too large to be represented
+	// exactly by a float64 (eg. 9007199254740993)
+	Big *big.Int
 }
 
 func (nl *NumberLiteral) expressionNode()      {}
@@ -435,6 +484,117 @@ func (fe *ForExpression) String() string {
 	return out.String()
 }
 
+// TryExpression runs a block and gives
+// the caller a chance to recover from
+// the errors it generates:
+//
+//	try {
+//	  ...
+//	} catch err {
+//	  ...
+//	} finally {
+//	  ...
+//	}
+//
+// Both the catch and the finally blocks
+// are optional, but at least one of them
+// has to be there.
+type TryExpression struct {
+	Token      token.Token     // The 'try' token
+	Block      *BlockStatement // The block we're trying to run
+	Identifier string          // The identifier the error is bound to (catch err {...})
+	Catch      *BlockStatement
+	Finally    *BlockStatement
+}
+
+func (te *TryExpression) expressionNode()      {}
+func (te *TryExpression) TokenLiteral() string { return te.Token.Literal }
+func (te *TryExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("try ")
+	out.WriteString(te.Block.String())
+
+	if te.Catch != nil {
+		out.WriteString(" catch ")
+
+		if te.Identifier != "" {
+			out.WriteString(te.Identifier + " ")
+		}
+
+		out.WriteString(te.Catch.String())
+	}
+
+	if te.Finally != nil {
+		out.WriteString(" finally ")
+		out.WriteString(te.Finally.String())
+	}
+
+	return out.String()
+}
+
+// match x {
+//
+//	0 => "zero",
+//	1..9 => "small",
+//	[a, b] if a > b => a,
+//	{"name": name} => name,
+//	_ => "something else"
+//
+// }
+//
+// The first arm whose pattern matches the
+// value (and whose guard, if any, is truthy)
+// is evaluated.
+type MatchExpression struct {
+	Token token.Token // The 'match' token
+	Value Expression  // The value we're matching against
+	Arms  []*MatchArm
+}
+
+func (me *MatchExpression) expressionNode()      {}
+func (me *MatchExpression) TokenLiteral() string { return me.Token.Literal }
+func (me *MatchExpression) String() string {
+	var out bytes.Buffer
+
+	arms := []string{}
+	for _, arm := range me.Arms {
+		arms = append(arms, arm.String())
+	}
+
+	out.WriteString("match ")
+	out.WriteString(me.Value.String())
+	out.WriteString(" {")
+	out.WriteString(strings.Join(arms, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
+// pattern if guard => body
+type MatchArm struct {
+	Token   token.Token // The '=>' token
+	Pattern Expression
+	Guard   Expression
+	Body    *BlockStatement
+}
+
+func (ma *MatchArm) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(ma.Pattern.String())
+
+	if ma.Guard != nil {
+		out.WriteString(" if ")
+		out.WriteString(ma.Guard.String())
+	}
+
+	out.WriteString(" => ")
+	out.WriteString(ma.Body.String())
+
+	return out.String()
+}
+
 type CommandExpression struct {
 	Token token.Token // The command itself
 	Value string
@@ -636,6 +796,7 @@ func (pe *PropertyExpression) String() string {
 type HashLiteral struct {
 	Token token.Token // the '{' token
 	Pairs map[Expression]Expression
+	Keys  []Expression // the keys, in the order they appear in the literal
 }
 
 func (hl *HashLiteral) expressionNode()      {}
@@ -644,8 +805,8 @@ func (hl *HashLiteral) String() string {
 	var out bytes.Buffer
 
 	pairs := []string{}
-	for key, value := range hl.Pairs {
-		pairs = append(pairs, key.String()+":"+value.String())
+	for _, key := range hl.Keys {
+		pairs = append(pairs, key.String()+":"+hl.Pairs[key].String())
 	}
 
 	out.WriteString("{")
@@ -77,12 +77,14 @@ module.exports = {
             'syntax/assignments',
             'syntax/return',
             'syntax/if',
+            'syntax/match',
             'syntax/for',
             'syntax/while',
             'syntax/system-commands',
             'syntax/operators',
             'syntax/comments',
             'syntax/defer',
+            'syntax/try',
           ]
         },
         {
@@ -116,6 +118,8 @@ module.exports = {
             'misc/error',
             'misc/configuring-the-repl',
             'misc/runtime',
+            'misc/filesystem',
+            'misc/http',
             'misc/technical-details',
             'misc/upgrade-from-abs-1-to-2',
             'misc/credits',
@@ -1,9 +1,23 @@
 package evaluator
 
 import (
+	"bytes"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/abs-lang/abs/lexer"
 	"github.com/abs-lang/abs/object"
+	"github.com/abs-lang/abs/parser"
 )
 
 type Tests struct {
@@ -89,6 +103,22 @@ func TestType(t *testing.T) {
 	testBuiltinFunction(tests, t)
 }
 
+func TestError(t *testing.T) {
+	tests := []Tests{
+		{`type(error("boom"))`, "ERROR"},
+		{`error("boom").message`, "boom"},
+		{`error("boom").kind`, "Error"},
+		{`error("boom", "IOError").kind`, "IOError"},
+		{`"boom".error().message`, "boom"},
+		{`error(1)`, "Wrong arguments passed to 'error'"},
+		{`x = error("boom"); 1`, 1},
+		{`try { throw error("boom", "IOError") } catch e { e.kind + ": " + e.message }`, "IOError: boom"},
+		{`throw error("boom", "IOError")`, "boom"},
+	}
+
+	testBuiltinFunction(tests, t)
+}
+
 func TestLen(t *testing.T) {
 	tests := []Tests{
 		{`len("")`, 0},
@@ -109,6 +139,12 @@ func TestInt(t *testing.T) {
 		{`int("10.5")`, 10},
 		{`int("abc")`, `int(...) can only be called on strings which represent numbers, 'abc' given`},
 		{`int([])`, "argument 0 to int(...) is not supported (got: [], allowed: NUMBER, STRING)"},
+		{`int(-10.5)`, -10},
+		{`int("123456789012345678901234567890").str()`, "123456789012345678901234567890"},
+		{`int(" 9007199254740993 ").str()`, "9007199254740993"},
+		{`int(2 ** 70 * 1.5).str()`, "1770887431076116955136"},
+		{`number("123456789012345678901234567890").str()`, "123456789012345678901234567890"},
+		{`str(2 ** 64)`, "18446744073709551616"},
 	}
 
 	testBuiltinFunction(tests, t)
@@ -123,6 +159,8 @@ func TestFind(t *testing.T) {
 		{`x = find([{}, {"y": 1, "z": 10}, {}], {"y": 1}); x.z`, 10},
 		{`x = find([{}, {"y": {}, "z": 10}, {}], {"y": {}}); x.z`, 10},
 		{`find([{}, {"y": "1", "z": 10}, {}], {"y": 1})`, nil},
+		{`x = find([{"y": {"a": 1, "b": [{"c": 2, "d": 3}]}, "z": 10}], {"y": {"b": [{"d": 3, "c": 2}], "a": 1}}); x.z`, 10},
+		{`find([{"y": {"a": 1, "b": 2}}], {"y": {"b": 2, "a": 2}})`, nil},
 	}
 
 	testBuiltinFunction(tests, t)
@@ -149,10 +187,682 @@ func TestJson(t *testing.T) {
 		{`'null'.json()`, nil},
 		{`'"hello"'.json()`, "hello"},
 		{`'[1, 2, 3]'.json()`, []int{1, 2, 3}},
-		{`'"hello'.json()`, "argument to `json` must be a valid JSON object, got '\"hello'"},
+		{`'"hello'.json()`, "argument to `json` must be a valid JSON document: unterminated string at [1:1]"},
+		{`'{"a": 1, "b": [true, null, 1.5e3]}'.json().b[2]`, 1500},
+		{`'{"c": 1, "a": 2, "b": 3}'.json().keys()`, []string{"c", "a", "b"}},
+		{`'{"a": 1, "a": 2}'.json().a`, 2},
+		{`'"\u00e8\ud83d\ude00\n\t\"\\\/"'.json()`, "è😀\n\t\"\\/"},
+		{`'"\ud800"'.json()`, "\ufffd"},
+		{`'-0.5E-2'.json()`, -0.005},
+		{`'12345678901234567890'.json().str()`, "12345678901234567890"},
+		{`'  [ ]  '.json().len()`, 0},
+		{`'[1, 2,]'.json()`, "argument to `json` must be a valid JSON document: unexpected character ']', expected a value at [1:7]"},
+		{`'{"a" 1}'.json()`, "argument to `json` must be a valid JSON document: unexpected character '1', expected ':' at [1:6]"},
+		{`'{"a": 1}}'.json()`, "argument to `json` must be a valid JSON document: unexpected character '}', expected end of input at [1:9]"},
+		{`'{a: 1}'.json()`, "argument to `json` must be a valid JSON document: unexpected character 'a', expected a string key at [1:2]"},
+		{`"{\n  \"a\": tru\n}".json()`, "argument to `json` must be a valid JSON document: unexpected character 't', expected a value at [2:8]"},
+		{`'01'.json()`, "argument to `json` must be a valid JSON document: unexpected character '1', expected end of input at [1:2]"},
+		{`'1.'.json()`, "argument to `json` must be a valid JSON document: unexpected end of input, expected a digit at [1:3]"},
+		{`'1e400'.json()`, "argument to `json` must be a valid JSON document: number 1e400 is out of range at [1:1]"},
+		{`'"\x"'.json()`, "argument to `json` must be a valid JSON document: invalid escape sequence \"\\\\x\" at [1:2]"},
+		{`'"\u12"'.json()`, "argument to `json` must be a valid JSON document: invalid unicode escape sequence"},
+		{`'[1, 2'.json()`, "argument to `json` must be a valid JSON document: unexpected end of input, expected ',' or ']' at [1:6]"},
+	}
+
+	testBuiltinFunction(tests, t)
+}
+
+func TestJsonEncode(t *testing.T) {
+	tests := []Tests{
+		{`json_encode({"b": 1, "a": [1.5, true, null, "x"]})`, `{"b": 1, "a": [1.5, true, null, "x"]}`},
+		{`{"b": 1, "a": 2}.json_encode({"sort_keys": true})`, `{"a": 2, "b": 1}`},
+		{`json_encode("a\"b\nc\td\re")`, `"a\"b\nc\td\re"`},
+		{`json_encode('a\b')`, `"a\\b"`},
+		{`json_encode(1)`, `1`},
+		{`json_encode(12345678901234567890)`, `12345678901234567890`},
+		{`json_encode(null)`, `null`},
+		{`json_encode([])`, `[]`},
+		{`json_encode({})`, `{}`},
+		{`json_encode({1: "a", true: "b", null: "c"})`, `{"1": "a", "true": "b", "null": "c"}`},
+		{`json_encode(f(x) {x})`, `"f(x) {x}"`},
+		{`json_encode(len)`, `"builtin function"`},
+		{`json_encode(error("oops", "MyError"))`, `{"message": "oops", "kind": "MyError", "file": "", "line": 1, "column": 18}`},
+		{`json_encode({"a": [1, {"b": 2}], "c": {}}, {"indent": 2})`, "{\n  \"a\": [\n    1,\n    {\n      \"b\": 2\n    }\n  ],\n  \"c\": {}\n}"},
+		{`json_encode([1, 2], {"indent": "\t"})`, "[\n\t1,\n\t2\n]"},
+		{`json_encode({"b": {"d": 1, "c": 2}, "a": 3}, {"indent": 1, "sort_keys": true})`, "{\n \"a\": 3,\n \"b\": {\n  \"c\": 2,\n  \"d\": 1\n }\n}"},
+		{`s = '{"z": [1, "\\n", {"y": null}], "x": 1.5}'; json_encode(s.json()) == '{"z": [1, "\\n", {"y": null}], "x": 1.5}'`, true},
+		{`json_encode(1, {"indent": -1})`, "the indent option to json_encode(...) must be a positive integer or a string, got -1"},
+		{`json_encode(1, {"indent": true})`, "option 'indent' to json_encode(...) is not supported (got: true, allowed: NUMBER, STRING)"},
+		{`json_encode(1, {"sort": true})`, "unknown option 'sort' to json_encode(...) (allowed: indent, sort_keys)"},
+		{`json_encode()`, "wrong number of arguments to json_encode(...): got=0, min=1, max=2"},
+	}
+
+	testBuiltinFunction(tests, t)
+}
+
+func TestRun(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("run() tests rely on unix utilities")
+	}
+
+	tests := []Tests{
+		{`run(["echo", "-n", "hello world"])`, "hello world"},
+		{`run(["echo", "-n", "a b", "'c'", '"d"', "\$e", "; rm -rf /"]).stdout`, `a b 'c' "d" $e ; rm -rf /`},
+		{`["echo", "-n", 1, 2].run()`, "1 2"},
+		{`run(["echo", "hi"]).ok`, true},
+		{`run(["sh", "-c", "echo out; echo err >&2; exit 3"]).exit_code`, 3},
+		{`run(["sh", "-c", "echo out; echo err >&2; exit 3"]).stdout`, "out\n"},
+		{`run(["sh", "-c", "echo out; echo err >&2; exit 3"])`, "err"},
+		{`run(["pwd"], {"cwd": "/"})`, "/"},
+		{`run(["sh", "-c", "echo -n \$ABS_RUN_TEST"], {"env": {"ABS_RUN_TEST": "some value"}})`, "some value"},
+		{`run(["cat"], {"stdin": "from stdin"})`, "from stdin"},
+		{`run(["sleep", "1"], {"timeout": 10}).ok`, false},
+		{`run(["sleep", "1"], {"timeout": 10}).exit_code`, -1},
+		{`run(["sleep", "1"], {"timeout": 10}).duration < 1000`, true},
+		{`run(["this-command-does-not-exist"]).ok`, false},
+		{`run(["this-command-does-not-exist"]).exit_code`, -1},
+		{`run(["this-command-does-not-exist"])`, `exec: "this-command-does-not-exist": executable file not found in $PATH`},
+		{`run([])`, "the command passed to run(...) cannot be empty"},
+		{`run([["ls"]])`, `the command passed to run(...) must be an array of strings, got [["ls"]]`},
+		{`run(["ls"], {"timeout": 0})`, "the timeout option to run(...) must be a positive number of milliseconds, got 0"},
+		{`run(["ls"], {"dir": "/"})`, "unknown option 'dir' to run(...) (allowed: cwd, env, safe, stdin, timeout)"},
+		{`run(["ls"], {"cwd": 1})`, "option 'cwd' to run(...) is not supported (got: 1, allowed: STRING)"},
+		{`run(["echo"]).timed_out`, false},
+		{`run(["sleep", "1"], {"timeout": 10}).timed_out`, true},
+		{`run(["sh", "-c", "echo -n \${HOME:-unset}"], {"env": {"HOME": null}})`, "unset"},
+		{`run(["sh", "-c", "echo -n \$ABS_RUN_TEST"], {"env": {"ABS_RUN_TEST": "a", "ABS_RUN_TEST": "b"}})`, "b"},
+		{"run(`pwd`, {'cwd': '/'})", "/"},
+		{"x = 'a  b'; run(`echo -n $x`)", "a  b"},
+		{"x = 'a  b'; run(\"echo -n $x\")", "a  b"},
+		{"x = 'a  b; echo injected'; \"echo -n $x\".run()", "a  b; echo injected"},
+		{"x = 'a  b; echo injected'; `echo -n $x`.run()", "a  b; echo injected"},
+		{"`echo -n a`.run({'timeout': 1000})", "a"},
+		{"run(`cat`, {'stdin': 'from stdin'})", "from stdin"},
+		{"run(`exit 2`).exit_code", 2},
+		{"run(`sleep 1; echo done`, {'timeout': 50}).timed_out", true},
+		{"run(`sleep 1; echo done`, {'timeout': 50}).ok", false},
+		{"run(`sleep 2; echo done`, {'timeout': 50}).duration < 1000", true},
+		{"run(`sleep 0.01`, {'timeout': 1000}).timed_out", false},
+		{"x = `echo a`; run(x)", "the command passed to run(...) has already been run, pass it directly instead: run(`cmd`)"},
+		{"exec('sleep 1', {'timeout': 50})", "command timed out after 50ms"},
+		{"exec('sleep 1', {'timeout': 50}).timed_out", true},
+		{"exec('sleep 1', {'timeout': 50}).ok", false},
+		{"exec('exit 0', {'timeout': 1000})", nil},
+		{"exec('ls', {'time': 1000})", "unknown option 'time' to exec(...) (allowed: cwd, env, safe, stdin, timeout)"},
+	}
+
+	testBuiltinFunction(tests, t)
+}
+
+func TestRunAll(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("run_all() tests rely on unix utilities")
+	}
+
+	tests := []Tests{
+		{"run_all([])", []string{}},
+		{"run_all([`echo a`, `echo b`, `echo c`])", []string{"a", "b", "c"}},
+		{"run_all([`sleep 0.05; echo a`, `echo b`], 2)", []string{"a", "b"}},
+		{"run_all([['echo', 'a  b'], 'echo c', `echo d`])", []string{"a  b", "c", "d"}},
+		{"x = 'a  b'; run_all([`echo $x`])", []string{"a  b"}},
+		{"run_all([['echo', `echo a`]])", []string{"a"}},
+		{"run_all([`exit 2`, `echo b`]).map(f(c) { return c.exit_code }).str()", "[2, 0]"},
+		{"run_all([`exit 2`, `echo b`]).map(f(c) { return c.ok }).str()", "[false, true]"},
+		{"run_all([['this-command-does-not-exist'], `echo b`])[1]", "b"},
+		{"start = unix_ms(); run_all([`sleep 0.2`, `sleep 0.2`, `sleep 0.2`], 3); unix_ms() - start < 500", true},
+		{"start = unix_ms(); run_all([`sleep 0.1`, `sleep 0.1`], 1); unix_ms() - start >= 200", true},
+		{"run_all([`echo a`], 0)", "the concurrency of run_all(...) must be a positive integer, got 0"},
+		{"run_all([`echo a`], 1.5)", "the concurrency of run_all(...) must be a positive integer, got 1.5"},
+		{"run_all([1])", "run_all(...) can only run commands, got 1"},
+		{"run_all([[]])", "the command passed to run_all(...) cannot be empty"},
+		{"x = `echo a`; run_all([x])", "the command passed to run_all(...) has already been run, pass it directly instead: run_all(`cmd`)"},
+		{"cmds = ['echo a', 'echo b']; run_all(cmds)", []string{"a", "b"}},
+		{"cmds = ['a', 'b'].map(f(x) { return ['echo', x] }); run_all(cmds)", []string{"a", "b"}},
+		{"cmds = ['sleep 0.2', 'sleep 0.2', 'sleep 0.2']; start = unix_ms(); run_all(cmds, 3); unix_ms() - start < 500", true},
+		{"strict(); run_all([`true`, `exit 3`, `exit 4`]).map(f(c) { return c.exit_code }).str()", "[0, 3, 4]"},
+	}
+
+	testBuiltinFunction(tests, t)
+}
+
+func TestParallel(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("parallel() tests rely on unix utilities")
+	}
+
+	tests := []Tests{
+		{"parallel([], f(x) { return x })", []string{}},
+		{"parallel([1, 2, 3], f(x) { return x * 2 })", []int{2, 4, 6}},
+		{"[1, 2].parallel(f(x) { return x + 1 }, {'concurrency': 1})", []int{2, 3}},
+		{"parallel([3, 1, 2], f(x) { return `sleep 0.0$x; echo $x` })", []string{"3", "1", "2"}},
+		{"start = unix_ms(); parallel([1, 2, 3], f(x) { sleep(200) }, {'concurrency': 3}); unix_ms() - start < 500", true},
+		{"start = unix_ms(); parallel([1, 2, 3], f(x) { `sleep 0.2` }, {'concurrency': 3}); unix_ms() - start < 500", true},
+		{"start = unix_ms(); parallel([1, 2], f(x) { `sleep 0.1` }, {'concurrency': 1}); unix_ms() - start >= 200", true},
+		{"hosts = ['a', 'b']; parallel(hosts, f(host) { return run(['echo', host]) })", []string{"a", "b"}},
+		{"r = parallel([1, 0], f(x) { if x == 0 { throw 'zero' }; return x }); [r[0], r[1].message].str()", `[1, "zero"]`},
+		{"strict(); r = parallel(['true', 'exit 3'], f(c) { return run(c) }); [r[0].ok, r[1].kind, r[1].exit_code].str()", `[true, "CommandError", 3]`},
+		{"f boom(x) { return x.nope() }; r = parallel([1], boom); r[0].stack.map(f(s) { return s.function }).str()", `["boom", "<main>"]`},
+		{"parallel([1], f(x) {}, {'concurrency': 0})", "the concurrency of parallel(...) must be a positive integer, got 0"},
+		{"parallel([1], f(x) {}, {'limit': 2})", "unknown option 'limit' to parallel(...) (allowed: concurrency)"},
+	}
+
+	testBuiltinFunction(tests, t)
+}
+
+func TestStream(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("stream() tests rely on unix utilities")
+	}
+
+	tests := []Tests{
+		{"lines = []; for l in stream(`printf 'a\\nb\\n\\nc'`) { lines.push(l) }; lines", []string{"a", "b", "", "c"}},
+		{"lines = []; for l in stream('echo a; echo b') { lines.push(l) }; lines", []string{"a", "b"}},
+		{"x = 'a  b'; lines = []; for l in stream(\"echo $x\") { lines.push(l) }; lines", []string{"a  b"}},
+		{"x = 'a b'; lines = []; for l in stream(`echo $x`) { lines.push(l) }; lines", []string{"a b"}},
+		{"x = 'a  b; echo injected'; lines = []; for l in \"echo $x\".stream() { lines.push(l) }; lines", []string{"a  b; echo injected"}},
+		{"x = 'a  b; echo injected'; lines = []; for l in `echo $x`.stream() { lines.push(l) }; lines", []string{"a  b; echo injected"}},
+		{"keys = []; for k, l in stream(`seq 3`) { keys.push(k) }; keys.join(',')", "0,1,2"},
+		{"s = stream(`echo a; exit 3`); for l in s {}; s.exit_code", 3},
+		{"s = stream(`echo a; exit 3`); for l in s {}; s.ok", false},
+		{"s = stream(`echo a`); for l in s {}; s.done", true},
+		{"s = stream(`echo a`); s.exit_code", nil},
+		{"s = stream(`echo a`); s.wait().ok", true},
+		{"s = stream(`seq 100000`); for l in s { if l == '3' { break } }; s.kill().done", true},
+		{"s = stream(`seq 10`); for l in s { if l == '3' { break } }; n = 0; for l in s { n += 1 }; n", 7},
+		{"s = stream(`seq 100000`); for l in s { break }; j = jobs(); s.kill(); [j.len(), j[0].command, j[0].state].str()", `[1, "seq 100000", "running"]`},
+		{"s = stream(`seq 100000`); for l in s { break }; wait_all().map(f(c) { return c.ok }).str()", "[true]"},
+		{"s = stream(`echo a`); for l in s {}; jobs()[0].state", "done"},
+		{"s = stream(`echo a`); for l in s {}; n = 0; for l in s { n += 1 }; n", 0},
+		{"s = `echo a`; stream(s)", "the command passed to stream(...) has already been run, pass it directly instead: stream(`cmd`)"},
+		{"s = stream(`echo a; sleep 2`, {'timeout': 100}); lines = []; for l in s { lines.push(l) }; [lines, s.timed_out].str()", `[["a"], true]`},
+		{"lines = []; for l in stream(`cat`, {'stdin': 'a\nb'}) { lines.push(l) }; lines", []string{"a", "b"}},
+		{"stream(`sleep 1 &`)", "stream(...) cannot run commands in background, remove the trailing '&' from `sleep 1 &`"},
+		{"stream('sleep 1 &')", "stream(...) cannot run commands in background, remove the trailing '&' from `sleep 1 &`"},
+	}
+
+	testBuiltinFunction(tests, t)
+}
+
+func TestJobs(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("job control tests rely on unix utilities")
+	}
+
+	tests := []Tests{
+		{"jobs()", []string{}},
+		{"`sleep 0.01`; jobs().len()", 0},
+		{"a = `sleep 0.01 &`; b = `sleep 0.01 &`; jobs().len()", 2},
+		{"a = `sleep 0.01 &`; jobs()[0].command", "sleep 0.01"},
+		{"a = `sleep 0.01 &`; jobs()[0].pid == a.pid", true},
+		{"a = `sleep 0.01 &`; jobs()[0].started <= unix_ms()", true},
+		{"a = `sleep 1 &`; s = jobs()[0].state; a.kill(); s", "running"},
+		{"a = `sleep 0.01 &`; a.wait(); jobs()[0].state", "done"},
+		{"a = `exit 1 &`; a.wait(); jobs()[0].state", "failed"},
+		{"a = `sleep 1 &`; signal(a, 'TERM'); a.wait(); jobs()[0].state", "killed"},
+		{"a = `sleep 0.01 &`; b = `sleep 0.02 &`; wait_all().map(f(c) { return c.done }).str()", "[true, true]"},
+		{"a = `sleep 0.01 &`; a.wait(); wait_all().len()", 0},
+		{"a = `sleep 1 &`; b = `sleep 0.01; echo b &`; c = wait_any([a, b]); a.kill(); c", "b"},
+		{"a = `echo a`; b = `sleep 1 &`; c = wait_any([b, a]); b.kill(); c", "a"},
+		{"wait_any([])", "wait_any(...) needs at least one command to wait for"},
+		{"wait_any(['a'])", "wait_any(...) can only wait for commands, got 'a'"},
+		{"a = `sleep 1 &`; signal(a, 'TERM'); a.wait(); a.exit_code", -1},
+		{"a = `sleep 1 &`; signal(a, 'sigterm'); a.wait(); a.ok", false},
+		{"a = `sleep 1 &`; signal(a, 9); a.wait(); a.done", true},
+		{"a = `sleep 1; echo done &`; signal(a, 'TERM'); a.wait(); a.duration < 500", true},
+		{"a = `sleep 0.01 &`; a.signal('CONT'); a.wait().ok", true},
+		{"a = `sleep 0.01 &`; signal(a, 'FOO')", "unknown signal 'FOO' (allowed: ALRM, CHLD, CONT, HUP, INT, KILL, PIPE, QUIT, STOP, TERM, TSTP, TTIN, TTOU, USR1, USR2, WINCH)"},
+		{"signal('a', 'TERM')", "signal(...) can only be sent to a command that was started, got 'a'"},
+	}
+
+	testBuiltinFunction(tests, t)
+}
+
+func TestFs(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fs tests rely on unix permissions")
+	}
+
+	os.RemoveAll("test-ignore-fs")
+	defer os.RemoveAll("test-ignore-fs")
+
+	tests := []Tests{
+		{`mkdir("test-ignore-fs/a/b")`, nil},
+		{`mkdir("test-ignore-fs/a/b")`, nil},
+		{`exists("test-ignore-fs/a/b")`, true},
+		{`exists("test-ignore-fs/nope")`, false},
+		{`write_file("test-ignore-fs/a/1.txt", "hello")`, nil},
+		{`read_file("test-ignore-fs/a/1.txt")`, "hello"},
+		{`append_file("test-ignore-fs/a/1.txt", " world"); read_file("test-ignore-fs/a/1.txt")`, "hello world"},
+		{`write_file("test-ignore-fs/a/1.txt", "replaced", {"atomic": true}); read_file("test-ignore-fs/a/1.txt")`, "replaced"},
+		{`write_file("test-ignore-fs/a/2.txt", "new", {"atomic": true}); stat("test-ignore-fs/a/2.txt").mode`, "0644"},
+		{`list_dir("test-ignore-fs/a")`, []string{"1.txt", "2.txt", "b"}},
+		{`walk("test-ignore-fs")`, []string{"test-ignore-fs/a", "test-ignore-fs/a/1.txt", "test-ignore-fs/a/2.txt", "test-ignore-fs/a/b"}},
+		{`stat("test-ignore-fs/a/1.txt").size`, 8},
+		{`stat("test-ignore-fs/a/1.txt").name`, "1.txt"},
+		{`stat("test-ignore-fs/a/1.txt").is_file`, true},
+		{`stat("test-ignore-fs/a").is_dir`, true},
+		{`stat("test-ignore-fs/a/1.txt").mtime > unix_ms() - 60000`, true},
+		{`chmod("test-ignore-fs/a/1.txt", "600"); stat("test-ignore-fs/a/1.txt").mode`, "0600"},
+		{`chmod("test-ignore-fs/a/1.txt", "rwx")`, `the mode passed to chmod(...) must be in octal notation, such as "755", got rwx`},
+		{`write_file("test-ignore-fs/a/3.txt", "three", {"atomic": true}); stat("test-ignore-fs/a/1.txt").mode`, "0600"},
+		{`write_file("test-ignore-fs/a/1.txt", "atomic", {"atomic": true}); stat("test-ignore-fs/a/1.txt").mode`, "0600"},
+		{`write_file("test-ignore-fs/a/1.txt", "x", {"sync": true})`, "unknown option 'sync' to write_file(...) (allowed: atomic)"},
+		{`copy("test-ignore-fs/a", "test-ignore-fs/c"); list_dir("test-ignore-fs/c")`, []string{"1.txt", "2.txt", "3.txt", "b"}},
+		{`read_file("test-ignore-fs/c/1.txt")`, "atomic"},
+		{`stat("test-ignore-fs/c/1.txt").mode`, "0600"},
+		{`move("test-ignore-fs/c/1.txt", "test-ignore-fs/c/4.txt"); list_dir("test-ignore-fs/c")`, []string{"2.txt", "3.txt", "4.txt", "b"}},
+		{`symlink("4.txt", "test-ignore-fs/c/link"); stat("test-ignore-fs/c/link").is_symlink`, true},
+		{`read_file("test-ignore-fs/c/link")`, "atomic"},
+		{`remove("test-ignore-fs/c"); exists("test-ignore-fs/c")`, false},
+		{`remove("test-ignore-fs/c")`, nil},
+		{`read_file("test-ignore-fs/nope")`, "open test-ignore-fs/nope: no such file or directory"},
+		{`try { read_file("test-ignore-fs/nope") } catch e { e.kind }`, "IOError"},
+		{`list_dir("test-ignore-fs/nope")`, "open test-ignore-fs/nope: no such file or directory"},
+		{`mkdir("test-ignore-fs/a/1.txt/x")`, "mkdir test-ignore-fs/a/1.txt: not a directory"},
+		{`"test-ignore-fs/a/2.txt".read_file()`, "new"},
+	}
+
+	testBuiltinFunction(tests, t)
+
+	// Just like redirection, relative paths are
+	// resolved against the current directory
+	// rather than the directory of the script
+	env := object.NewEnvironment(object.SystemStdio, "test-ignore-fs/script", "test_version", false)
+	lex := lexer.New(`write_file("test-ignore-fs/d.txt", "fs"); "redirect" > "test-ignore-fs/e.txt"; [read_file("test-ignore-fs/d.txt"), read_file("test-ignore-fs/e.txt"), exists("test-ignore-fs/script")].str()`)
+	expected := `["fs", "redirect", false]`
+
+	if res := BeginEval(parser.New(lex).ParseProgram(), env, lex).Inspect(); res != expected {
+		t.Errorf("expected %s, got %s", expected, res)
+	}
+}
+
+func TestGlob(t *testing.T) {
+	os.RemoveAll("test-ignore-glob")
+	defer os.RemoveAll("test-ignore-glob")
+
+	tests := []Tests{
+		{`mkdir("test-ignore-glob/src/lib/util"); glob("test-ignore-glob/**/*.go")`, []string{}},
+		{`write_file("test-ignore-glob/src/main.go", ""); write_file("test-ignore-glob/src/lib/util/strings.go", ""); write_file("test-ignore-glob/src/README.md", ""); glob("test-ignore-glob/src/**/*.go")`, []string{"test-ignore-glob/src/lib/util/strings.go", "test-ignore-glob/src/main.go"}},
+		{`glob("test-ignore-glob/src/*")`, []string{"test-ignore-glob/src/README.md", "test-ignore-glob/src/lib", "test-ignore-glob/src/main.go"}},
+		{`glob("test-ignore-glob/src/*.md")`, []string{"test-ignore-glob/src/README.md"}},
+		{`glob("test-ignore-glob/src/lib/**")`, []string{"test-ignore-glob/src/lib", "test-ignore-glob/src/lib/util", "test-ignore-glob/src/lib/util/strings.go"}},
+		{`glob("test-ignore-glob/src/[")`, "invalid pattern test-ignore-glob/src/[: syntax error in pattern"},
+		{`glob(1)`, "argument 0 to glob(...) is not supported (got: 1, allowed: STRING)"},
+	}
+
+	testBuiltinFunction(tests, t)
+
+	// Relative patterns and paths are resolved
+	// against the directory of the script, and
+	// matches are relative to it as well
+	cwd, _ := os.Getwd()
+	env := object.NewEnvironment(object.SystemStdio, "test-ignore-glob", "test_version", false)
+	lex := lexer.New(`[glob("src/*.md"), glob("./src/*.md"), path.rel("src/main.go"), path.rel("src/main.go", "src"), path.abs("src")].str()`)
+	expected := `[["src/README.md"], ["src/README.md"], "src/main.go", "main.go", "` + cwd + `/test-ignore-glob/src"]`
+
+	if res := BeginEval(parser.New(lex).ParseProgram(), env, lex).Inspect(); res != expected {
+		t.Errorf("expected %s, got %s", expected, res)
+	}
+}
+
+func TestPath(t *testing.T) {
+	cwd, _ := os.Getwd()
+
+	tests := []Tests{
+		{`path.join("a", "b", "c.txt")`, "a/b/c.txt"},
+		{`path.join("/a", "../b", "c.txt")`, "/b/c.txt"},
+		{`path.join()`, ""},
+		{`path.join("a", 1)`, "Wrong arguments passed to 'path.join'. Usage:\npath.join(STRING, ...)"},
+		{`path.base("/a/b.txt")`, "b.txt"},
+		{`path.dir("/a/b.txt")`, "/a"},
+		{`path.ext("/a/b.tar.gz")`, ".gz"},
+		{`path.ext("/a/b")`, ""},
+		{`path.clean("a/../b/./c.txt")`, "b/c.txt"},
+		{`path.abs("/a/b.txt")`, "/a/b.txt"},
+		{`path.abs("b.txt")`, cwd + "/b.txt"},
+		{`path.rel("/a/b/c.txt", "/a")`, "b/c.txt"},
+		{`path.rel("/a/c.txt", "/a/b")`, "../c.txt"},
+		{`path.rel("b/c.txt")`, "b/c.txt"},
+		{`path.base(1)`, "argument 0 to path.base(...) is not supported (got: 1, allowed: STRING)"},
+		{`path = "x"; path`, "x"},
+		{`p = path; p.join = f(a, b) { "hijacked" }; path.join("a", "b")`, "a/b"},
+		{`path.join = f(a, b) { "hijacked" }; path.join("a", "b")`, "a/b"},
+		{`h = http; h.get = 1; type(http.get)`, "BUILTIN"},
+		{`path.keys().str()`, `["abs", "base", "clean", "dir", "ext", "join", "rel"]`},
+	}
+
+	testBuiltinFunction(tests, t)
+}
+
+func TestTmp(t *testing.T) {
+	tests := []Tests{
+		{`f scratch() { p = tmp_file(); write_file(p, "hello"); return [p, p.read_file()] }; r = scratch(); [r[1], exists(r[0])].join(" ")`, "hello false"},
+		{`f scratch() { d = tmp_dir(); write_file(path.join(d, "1.txt"), ""); return [d, list_dir(d).len()] }; r = scratch(); [r[1], exists(r[0])].join(" ")`, "1 false"},
+		{`f scratch() { d = tmp_dir(); d }; exists(scratch())`, false},
+		{`seen = []; f scratch() { d = tmp_dir(); defer seen.push(exists(d).str()); d }; scratch(); seen[0]`, "true"},
+		{`f scratch() { d = tmp_dir({"keep": true}); d }; d = scratch(); k = exists(d); remove(d); k`, true},
+		{`f scratch() { p = tmp_file({"pattern": "build-*.log"}); [path.base(p).prefix("build-"), path.ext(p)].join(" ") }; scratch()`, "true .log"},
+		{`stat(tmp_dir()).is_dir`, true},
+		{`try { tmp_file({"pattern": "a/*"}) } catch e { e.kind }`, "IOError"},
+		{`tmp_file({"keep": 1})`, "option 'keep' to tmp_file(...) is not supported (got: 1, allowed: BOOLEAN)"},
+		{`tmp_dir({"dir": "/tmp"})`, "unknown option 'dir' to tmp_dir(...) (allowed: keep, pattern)"},
+	}
+
+	testBuiltinFunction(tests, t)
+
+	// Outside of functions, temporary files
+	// are removed as the script exits
+	env := object.NewEnvironment(object.SystemStdio, "", "test_version", false)
+	lex := lexer.New(`tmp_file()`)
+	path := BeginEval(parser.New(lex).ParseProgram(), env, lex).Inspect()
+
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("expected %s to exist until the script exits: %s", path, err)
+	}
+
+	AtExit(env)
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected %s to be removed as the script exits", path)
+	}
+}
+
+func TestHTTP(t *testing.T) {
+	handler := http.NewServeMux()
+	handler.HandleFunc("/echo", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		user, password, _ := r.BasicAuth()
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Add("X-Abs", "a")
+		w.Header().Add("X-Abs", "b")
+		json.NewEncoder(w).Encode(map[string]string{
+			"method":        r.Method,
+			"query":         r.URL.RawQuery,
+			"body":          string(body),
+			"content_type":  r.Header.Get("Content-Type"),
+			"custom":        r.Header.Get("X-Custom"),
+			"authorization": r.Header.Get("Authorization"),
+			"user":          user,
+			"password":      password,
+		})
+	})
+	handler.HandleFunc("/missing", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "not here", http.StatusNotFound)
+	})
+	handler.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/echo", http.StatusFound)
+	})
+	handler.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	})
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	// Requests to the TLS server fail on purpose
+	// when the certificate is not trusted: let's
+	// not log them
+	tlsServer := httptest.NewUnstartedServer(handler)
+	tlsServer.Config.ErrorLog = log.New(io.Discard, "", 0)
+	tlsServer.StartTLS()
+	defer tlsServer.Close()
+
+	ca := "test-ignore-http-ca.pem"
+	os.WriteFile(ca, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tlsServer.Certificate().Raw}), 0644)
+	defer os.Remove(ca)
+
+	tests := []Tests{
+		{`http.get("URL/echo").status`, 200},
+		{`http.get("URL/echo").json().method`, "GET"},
+		{`http.get("URL/echo").headers["content-type"]`, "application/json"},
+		{`http.get("URL/echo").headers["x-abs"]`, "a, b"},
+		{`http.get("URL/echo?a=1", {"query": {"b": 2, "c": "x y"}}).json().query`, "a=1&b=2&c=x+y"},
+		{`http.get("URL/echo", {"headers": {"X-Custom": "yes"}}).json().custom`, "yes"},
+		{`http.post("URL/echo", {"body": "hello"}).json().body`, "hello"},
+		{`r = http.post("URL/echo", {"json": {"a": [1, 2]}}).json(); r.body + " " + r.content_type`, `{"a": [1, 2]} application/json`},
+		{`http.post("URL/echo", {"json": 1, "headers": {"Content-Type": "text/plain"}}).json().content_type`, "text/plain"},
+		{`http.put("URL/echo").json().method`, "PUT"},
+		{`http.delete("URL/echo").json().method`, "DELETE"},
+		{`http.request("patch", "URL/echo").json().method`, "PATCH"},
+		{`http.get("URL/echo", {"bearer": "token"}).json().authorization`, "Bearer token"},
+		{`r = http.get("URL/echo", {"basic_auth": ["user", "secret"]}).json(); r.user + ":" + r.password`, "user:secret"},
+		{`r = http.get("URL/missing"); r.status.str() + " " + r.body`, "404 not here\n"},
+		{`r = http.get("URL/redirect"); r.status.str() + " " + r.url`, "200 URL/echo"},
+		{`r = http.get("URL/redirect", {"redirects": 0}); r.status.str() + " " + r.headers.location`, "302 /echo"},
+		{`try { http.get("URL/slow", {"timeout": 50}) } catch e { e.kind }`, "HTTPError"},
+		{`try { http.get("TLS/echo") } catch e { e.kind }`, "HTTPError"},
+		{`http.get("TLS/echo", {"insecure": true}).status`, 200},
+		{`http.get("TLS/echo", {"ca": "CA"}).status`, 200},
+		{`http.get("TLS/echo", {"ca": "test-ignore-http-nope.pem"})`, "open test-ignore-http-nope.pem: no such file or directory"},
+		{`http.get("nope")`, "invalid url passed to http.get(...): nope"},
+		{`http.get("URL/echo", {"retries": 1})`, "unknown option 'retries' to http.get(...) (allowed: basic_auth, bearer, body, ca, headers, insecure, json, query, redirects, safe, timeout)"},
+		{`http.post("URL/echo", {"body": "", "json": {}})`, "the body and json options to http.post(...) cannot be used together"},
+		{`http.get("URL/echo", {"basic_auth": ["user"]})`, "the basic_auth option to http.get(...) must be a [user, password] pair, got [\"user\"]"},
+		{`http.get("URL/echo", {"redirects": -1})`, "the redirects option to http.get(...) must be a positive integer, got -1"},
+		{`http.request("GET")`, "wrong number of arguments to http.request(...): got=1, min=2, max=3"},
+	}
+
+	for i, tt := range tests {
+		input := strings.ReplaceAll(tt.input, "URL", server.URL)
+		input = strings.ReplaceAll(input, "TLS", tlsServer.URL)
+		tests[i].input = strings.ReplaceAll(input, "CA", ca)
+
+		if expected, ok := tt.expected.(string); ok {
+			tests[i].expected = strings.ReplaceAll(expected, "URL", server.URL)
+		}
+	}
+
+	testBuiltinFunction(tests, t)
+}
+
+func TestHTTPServe(t *testing.T) {
+	// Let's find a port nobody's using
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := listener.Addr().String()
+	listener.Close()
+
+	input := `http.serve("ADDR", {
+		"GET /users/{id}": f(req) { return {"json": {"id": req.params.id, "page": req.query.page, "agent": req.headers["x-agent"]}} },
+		"POST /hooks/{name...}": f(req) { return {"status": 201, "headers": {"X-Hook": req.params.name}, "body": req.json().event} },
+		"GET /text": f(req) { "hello" },
+		"GET /boom": f(req) { x.y },
+		"GET /number": f(req) { 1 },
+		"GET /status": f(req) { {"status": 1} },
+		"GET /slow": f(req) { sleep(500); "slow" },
+		"GET /stop": f(req) { exit(7) },
+	})`
+
+	stderr := &bytes.Buffer{}
+	env := object.NewEnvironment(&object.Stdio{Stdin: os.Stdin, Stdout: os.Stdout, Stderr: stderr}, "", "test_version", false)
+	lex := lexer.New(strings.ReplaceAll(input, "ADDR", addr))
+	result := make(chan object.Object)
+	go func() {
+		result <- BeginEval(parser.New(lex).ParseProgram(), env, lex)
+	}()
+
+	url := "http://" + addr
+	for i := 0; i < 100; i++ {
+		if _, err := http.Get(url + "/text"); err == nil {
+			break
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	tests := []struct {
+		method   string
+		path     string
+		body     string
+		status   int
+		header   string
+		expected string
+	}{
+		{"GET", "/users/42?page=2", "", 200, "application/json", `{"id": "42", "page": "2", "agent": "abs"}`},
+		{"POST", "/hooks/github/push", `{"event": "push"}`, 201, "github/push", "push"},
+		{"GET", "/text", "", 200, "", "hello"},
+		{"DELETE", "/users/42", "", 405, "", "Method Not Allowed\n"},
+		{"GET", "/nope", "", 404, "", "404 page not found\n"},
+		{"GET", "/boom", "", 500, "", "Internal Server Error"},
+		{"GET", "/number", "", 500, "", "Internal Server Error"},
+		{"GET", "/status", "", 500, "", "Internal Server Error"},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, url+tt.path, strings.NewReader(tt.body))
+		req.Header.Set("X-Agent", "abs")
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request to %s failed: %s", tt.path, err)
+		}
+
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+
+		if res.StatusCode != tt.status {
+			t.Errorf("wrong status for %s %s. expected=%d, got=%d", tt.method, tt.path, tt.status, res.StatusCode)
+		}
+
+		if tt.header != "" && res.Header.Get("Content-Type") != tt.header && res.Header.Get("X-Hook") != tt.header {
+			t.Errorf("wrong headers for %s %s. expected=%q, got=%v", tt.method, tt.path, tt.header, res.Header)
+		}
+
+		if string(body) != tt.expected {
+			t.Errorf("wrong body for %s %s. expected=%q, got=%q", tt.method, tt.path, tt.expected, string(body))
+		}
+	}
+
+	// Requests are served while a slow
+	// handler is waiting
+	slow := make(chan string)
+	go func() {
+		res, err := http.Get(url + "/slow")
+		if err != nil {
+			slow <- err.Error()
+			return
+		}
+
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		slow <- string(body)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	start := time.Now()
+	if _, err := http.Get(url + "/text"); err != nil || time.Since(start) > 250*time.Millisecond {
+		t.Errorf("expected a request to be served while a slow handler runs, took %s (%v)", time.Since(start), err)
+	}
+
+	if body := <-slow; body != "slow" {
+		t.Errorf("wrong body for GET /slow. expected=%q, got=%q", "slow", body)
+	}
+
+	http.Get(url + "/stop")
+
+	select {
+	case res := <-result:
+		exit, ok := res.(*object.ExitError)
+		if !ok || exit.Code != 7 {
+			t.Errorf("expected the server to exit with code 7, got %s", res.Inspect())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the server did not stop")
+	}
+
+	expected := []string{
+		"identifier not found: x",
+		"the functions passed to http.serve(...) must return an hash or a string, got NUMBER",
+		"invalid status returned to http.serve(...): 1",
+	}
+
+	for _, e := range expected {
+		if !strings.Contains(stderr.String(), e) {
+			t.Errorf("expected %q to be printed, got %q", e, stderr.String())
+		}
+	}
+
+	if runtime.GOOS != "windows" {
+		// The server stops gracefully on TERM, responding
+		// to the request that's being served
+		input := "r = http.serve('" + addr + "', f(req) { `kill -TERM \\$PPID`; 'bye' }); [r, 'stopped']"
+		lex := lexer.New(input)
+		go func() {
+			result <- BeginEval(parser.New(lex).ParseProgram(), object.NewEnvironment(object.SystemStdio, "", "test_version", false), lex)
+		}()
+
+		var body []byte
+		for i := 0; i < 100; i++ {
+			if res, err := http.Get(url); err == nil {
+				body, _ = io.ReadAll(res.Body)
+				res.Body.Close()
+				break
+			}
+
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		if string(body) != "bye" {
+			t.Errorf("expected the server to respond while stopping, got %q", string(body))
+		}
+
+		select {
+		case res := <-result:
+			if res.Inspect() != `[null, "stopped"]` {
+				t.Errorf("expected the script to go on once the server stopped, got %s", res.Inspect())
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("the server did not stop on TERM")
+		}
+	}
+
+	serveTests := []Tests{
+		{`http.serve("127.0.0.1:0", {"GET /": 1})`, "the route 'GET /' passed to http.serve(...) must be a function, got NUMBER"},
+		{`http.serve("127.0.0.1:0", {"GET /users/{": f(req) {}})`, "invalid route passed to http.serve(...): parsing \"GET /users/{\": at offset 11: bad wildcard segment (must end with '}')"},
+		{`http.serve("nope", f(req) {})`, "listen tcp: address nope: missing port in address"},
+		{`http.serve(":8080")`, "wrong number of arguments to http.serve(...): got=1, want=2"},
+	}
+
+	testBuiltinFunction(serveTests, t)
+}
+
+func TestWatch(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("watch() tests rely on unix utilities")
+	}
+
+	os.RemoveAll("test-ignore-watch")
+	for _, dir := range []string{"create", "write", "remove", "recursive", "stop", "error", "script"} {
+		os.MkdirAll("test-ignore-watch/"+dir, 0755)
+	}
+	os.WriteFile("test-ignore-watch/write/a.txt", []byte("a"), 0644)
+	os.WriteFile("test-ignore-watch/remove/a.txt", []byte("a"), 0644)
+	defer os.RemoveAll("test-ignore-watch")
+
+	tests := []Tests{
+		{"`sleep 0.1; echo a > test-ignore-watch/create/a.txt &`; events = []; watch('test-ignore-watch/create', f(event) { events.push(event); return false }, {'interval': 20}); [events[0].op, events[0].path]", []string{"create", "test-ignore-watch/create/a.txt"}},
+		{"`sleep 0.1; echo ab > test-ignore-watch/write/a.txt &`; events = []; watch(['test-ignore-watch/write/a.txt'], f(event) { events.push(event); return false }, {'interval': 20}); events[0].op", "write"},
+		{"`sleep 0.1; rm test-ignore-watch/remove/a.txt &`; events = []; watch('test-ignore-watch/remove', f(event) { events.push(event); return false }, {'interval': 20}); events[0].op", "remove"},
+		{"`sleep 0.1; mkdir -p test-ignore-watch/recursive/x/y; touch test-ignore-watch/recursive/x/y/z &`; paths = []; watch('test-ignore-watch/recursive', f(event) { paths.push(event.path); return paths.len() < 3 }, {'interval': 20, 'recursive': true, 'debounce': 100}); paths", []string{"test-ignore-watch/recursive/x", "test-ignore-watch/recursive/x/y", "test-ignore-watch/recursive/x/y/z"}},
+		{"`sleep 0.1; touch test-ignore-watch/stop/a &`; start = unix_ms(); watch('test-ignore-watch/stop', f(event) { return false }, {'interval': 20}); type(start)", "NUMBER"},
+		{"`sleep 0.1; touch test-ignore-watch/error/a &`; watch('test-ignore-watch/error', f(event) { throw 'boom' }, {'interval': 20})", "boom"},
+		{"on_signal('USR1', f(sig) { throw 'interrupted' }); `sleep 0.1; kill -USR1 \\$PPID &`; watch('test-ignore-watch/stop', f(event) { return false }, {'interval': 20})", "interrupted"},
+		{"watch('test-ignore-watch', f(event) { return false }, {'interval': 0})", "the interval option to watch(...) must be a positive number of milliseconds, got 0"},
+		{"watch('test-ignore-watch', f(event) { return false }, {'debounce': -1})", "the debounce option to watch(...) cannot be negative, got -1"},
+		{"watch([1], f(event) { return false })", "the paths passed to watch(...) must be strings, got [1]"},
+		{"watch('test-ignore-watch', f(event) { return false }, {'deep': true})", "unknown option 'deep' to watch(...) (allowed: debounce, interval, recursive)"},
 	}
 
 	testBuiltinFunction(tests, t)
+
+	// Paths are watched within the current
+	// directory, wherever the script is
+	env := object.NewEnvironment(object.SystemStdio, "test-ignore-watch/stop", "test_version", false)
+	lex := lexer.New("`sleep 0.1; touch test-ignore-watch/script/a &`; paths = []; watch('./test-ignore-watch/script', f(event) { paths.push(event.path); return false }, {'interval': 20}); paths.str()")
+	expected := `["test-ignore-watch/script/a"]`
+
+	if res := BeginEval(parser.New(lex).ParseProgram(), env, lex).Inspect(); res != expected {
+		t.Errorf("expected %s, got %s", expected, res)
+	}
 }
 
 func TestRand(t *testing.T) {
@@ -258,6 +968,9 @@ func TestTsv(t *testing.T) {
 		{`[[1,2,3], [2,3,4]].tsv("abc")`, "1a2a3\n2a3a4"},
 		{`[[1,2,3], [2,3,4]].tsv("")`, "the separator argument to the tsv() function needs to be a valid character, '' given"},
 		{`[{"c": 3, "b": "hello"}, {"b": 20, "c": 0}].tsv("\t", ["c", "b", "a"])`, "c\tb\ta\n3\thello\tnull\n0\t20\tnull"},
+		{`[{2: "b", 1: "a"}, {1: "c", true: "d"}].tsv(",")`, "1,2,true\na,b,null\nc,null,d"},
+		{`[{1: "a", "1": "b"}].tsv(",")`, "1,1\na,b"},
+		{`[{1: "a", "1": "b"}].tsv(",", [1])`, "1\na"},
 	}
 
 	testBuiltinFunction(tests, t)
@@ -316,6 +1029,10 @@ func TestSort(t *testing.T) {
 		{`["b", 1].sort()`, `argument to 'sort' must be an homogeneous array (elements of the same type), got ["b", 1]`},
 		{`[{}].sort()`, "cannot sort an array with given elements elements ([{}])"},
 		{`[[]].sort()`, "cannot sort an array with given elements elements ([[]])"},
+		{`{"b": 1, "c": 2, "a": 3}.sort().keys()`, []string{"a", "b", "c"}},
+		{`{10: 1, 9: 2, 2: 3}.sort().keys()`, []int{2, 9, 10}},
+		{`{"b": 1, 1: 2, true: 3, "a": 4}.sort().str()`, `{true: 3, 1: 2, "a": 4, "b": 1}`},
+		{`h = {"b": 1, "a": 2}; h.sort(); h.keys()`, []string{"b", "a"}},
 	}
 
 	testBuiltinFunction(tests, t)
@@ -420,6 +1137,16 @@ func TestKeys(t *testing.T) {
 	tests := []Tests{
 		{`[1, 2].keys()`, []int{0, 1}},
 		{`{'a': 1}.keys()`, []string{"a"}},
+		{`{1: 'a'}.keys()`, []int{1}},
+		{`{1: 'a'}.keys().map(type)`, []string{"NUMBER"}},
+		{`{true: 'a'}.keys()[0] == true`, true},
+		{`{null: 'a'}.keys()[0] == null`, true},
+		{`{1: 'a'}.items()[0][0] + 1`, 2},
+		{`{'c': 1, 'a': 2, 'b': 3}.keys()`, []string{"c", "a", "b"}},
+		{`{'c': 1, 'a': 2, 'b': 3}.values()`, []int{1, 2, 3}},
+		{`{'c': 1, 'a': 2}.items().str()`, `[["c", 1], ["a", 2]]`},
+		{`h = {'c': 1, 'a': 2, 'b': 3}; h.pop('a'); h.a = 4; h.keys()`, []string{"c", "b", "a"}},
+		{`h = {'c': 1, 'a': 2}; h.c = 3; h.keys()`, []string{"c", "a"}},
 	}
 
 	testBuiltinFunction(tests, t)
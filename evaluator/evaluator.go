@@ -5,11 +5,14 @@ import (
 	"fmt"
 	"io/ioutil"
 	"math"
+	"math/big"
 	"os"
 	"os/exec"
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/abs-lang/abs/ast"
 	"github.com/abs-lang/abs/lexer"
@@ -24,13 +27,87 @@ var (
 	TRUE  = object.TRUE
 	FALSE = object.FALSE
 	Fns   map[string]*object.Builtin
+	// Builtin functions grouped under a name,
+	// such as path.join(...)
+	Modules map[string]map[string]*object.Builtin
 )
 
 // This program's lexer used for error location in Eval(program)
 var lex *lexer.Lexer
 
+// The file the lexer is reading code from,
+// empty when evaluating code from the REPL
+var lexFile string
+
+// A call the evaluator is currently going through,
+// either to a function or to a sourced file.
+// We keep track of these so that errors can report
+// the full stack of calls that led to them.
+type call struct {
+	// The function being called
+	function string
+	// Where the call happened
+	tok  token.Token
+	lex  *lexer.Lexer
+	file string
+}
+
+var callStack []call
+
+// Name of the frame representing the top-level
+// code of a script
+const mainFrame = "<main>"
+
+// Code is evaluated by one goroutine at a time,
+// the one holding this lock: functions running
+// concurrently, such as the ones of parallel(...),
+// take turns, giving way to each other while they
+// wait on commands, requests or sleep(...).
+// The lock starts out held by the goroutine
+// evaluating the script.
+var turn sync.Mutex
+
+// Where a goroutine is in the code, so that
+// it can resume from there once it's its turn
+type position struct {
+	lex       *lexer.Lexer
+	file      string
+	callStack []call
+}
+
+// yield lets other goroutines evaluate code while
+// the current one waits, such as on a command.
+// Once done waiting, resume() waits for its turn
+// and picks up where the goroutine was.
+func yield() (resume func()) {
+	p := position{lex, lexFile, callStack}
+	turn.Unlock()
+
+	return func() {
+		turn.Lock()
+		lex, lexFile, callStack = p.lex, p.file, p.callStack
+	}
+}
+
+// takeTurn evaluates code from a new goroutine,
+// starting at the position of the code that
+// started it, as soon as it's its turn.
+func takeTurn(p position, eval func()) {
+	turn.Lock()
+	defer turn.Unlock()
+
+	// Each goroutine has its own stack,
+	// so that calls don't overwrite the
+	// ones of other goroutines
+	lex, lexFile = p.lex, p.file
+	callStack = append([]call{}, p.callStack...)
+	eval()
+}
+
 func init() {
+	turn.Lock()
 	Fns = GetFns()
+	Modules = GetModules()
 	if os.Getenv("ABS_COMMAND_EXECUTOR") == "" {
 		// Set the executor for system commands
 		// thanks to @haifenghuang
@@ -43,10 +120,70 @@ func init() {
 }
 
 func newError(tok token.Token, format string, a ...interface{}) *object.Error {
-	// get the token position from the error node and append the offending line to the error message
-	lineNum, column, errorLine := lex.ErrorLine(tok.Position)
-	errorPosition := fmt.Sprintf("\n\t[%d:%d]\t%s", lineNum, column, errorLine)
-	return &object.Error{Message: fmt.Sprintf(format, a...) + errorPosition}
+	return newKindError(tok, object.GENERIC_ERROR, format, a...)
+}
+
+// newKindError creates an error of a specific
+// kind (eg. TypeError), so that users can tell
+// errors apart without looking at their message.
+func newKindError(tok token.Token, kind string, format string, a ...interface{}) *object.Error {
+	stack := stackTrace(tok)
+	frame := stack[0]
+
+	return &object.Error{
+		Message: fmt.Sprintf(format, a...),
+		Kind:    kind,
+		Line:    frame.Line,
+		Column:  frame.Column,
+		File:    frame.File,
+		Code:    frame.Code,
+		Stack:   stack,
+	}
+}
+
+// stackTrace returns the frames that led to the given
+// token, starting from the token itself and going up
+// to the top-level code of the script.
+func stackTrace(tok token.Token) []object.Frame {
+	frames := []object.Frame{newFrame(currentFunction(len(callStack)), lex, lexFile, tok)}
+
+	for i := len(callStack) - 1; i >= 0; i-- {
+		c := callStack[i]
+		frames = append(frames, newFrame(currentFunction(i), c.lex, c.file, c.tok))
+	}
+
+	return frames
+}
+
+// currentFunction returns the name of the function
+// we were in when the call stack had the given depth
+func currentFunction(depth int) string {
+	if depth == 0 {
+		return mainFrame
+	}
+
+	return callStack[depth-1].function
+}
+
+func newFrame(function string, l *lexer.Lexer, file string, tok token.Token) object.Frame {
+	// get the token position, along with the offending line
+	lineNum, column, errorLine := l.ErrorLine(tok.Position)
+
+	return object.Frame{Function: function, File: file, Line: lineNum, Column: column, Code: errorLine}
+}
+
+// wrapError creates an error out of another one
+// raised while evaluating a different piece of code,
+// such as a sourced file. The original error is
+// appended to the message, and its kind and stack
+// are preserved: the stack already includes
+// the frame where the code was called from.
+func wrapError(tok token.Token, err *object.Error, format string, a ...interface{}) *object.Error {
+	wrapped := newKindError(tok, err.Kind, format, a...)
+	wrapped.Message += "\n\t" + strings.TrimPrefix(err.Inspect(), "ERROR: ")
+	wrapped.Stack = err.Stack
+
+	return wrapped
 }
 
 func newBreakError(tok token.Token, format string, a ...interface{}) *object.BreakError {
@@ -57,12 +194,17 @@ func newContinueError(tok token.Token, format string, a ...interface{}) *object.
 	return &object.ContinueError{Error: *newError(tok, format, a...)}
 }
 
+func newExitError(tok token.Token, code int) *object.ExitError {
+	return &object.ExitError{Error: *newError(tok, "exit(%d) called", code), Code: code}
+}
+
 // BeginEval (program, env, lexer) object.Object
 // REPL and testing modules call this function to init the global lexer pointer for error location
 // NB. Eval(node, env) is recursive
 func BeginEval(program ast.Node, env *object.Environment, lexer *lexer.Lexer) object.Object {
 	// global lexer
 	lex = lexer
+	lexFile = env.File
 	// run the evaluator
 	return Eval(program, env)
 }
@@ -77,16 +219,27 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return evalBlockStatement(node, env)
 
 	case *ast.ExpressionStatement:
+		traceStatement(env, node.Token, node)
 		return Eval(node.Expression, env)
 
 	case *ast.ReturnStatement:
+		traceStatement(env, node.Token, node)
 		val := Eval(node.ReturnValue, env)
 		if isError(val) {
 			return val
 		}
 		return &object.ReturnValue{Value: val}
 
+	case *ast.ThrowStatement:
+		traceStatement(env, node.Token, node)
+		val := Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		return evalThrow(node.Token, val)
+
 	case *ast.AssignStatement:
+		traceStatement(env, node.Token, node)
 		err := evalAssignment(node, env)
 
 		if isError(err) {
@@ -96,6 +249,10 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return NULL
 	// Expressions
 	case *ast.NumberLiteral:
+		if node.Big != nil {
+			return object.NewBigNumber(node.Token, new(big.Int).Set(node.Big))
+		}
+
 		return &object.Number{Token: node.Token, Value: node.Value}
 
 	case *ast.NullLiteral:
@@ -135,6 +292,12 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 	case *ast.ForInExpression:
 		return evalForInExpression(node, env)
 
+	case *ast.TryExpression:
+		return evalTryExpression(node, env)
+
+	case *ast.MatchExpression:
+		return evalMatchExpression(node, env)
+
 	case *ast.Identifier:
 		return evalIdentifier(node, env)
 
@@ -142,7 +305,7 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		params := node.Parameters
 		body := node.Body
 		name := node.Name
-		fn := &object.Function{Token: node.Token, Parameters: params, Env: env, Body: body, Name: name, Node: node}
+		fn := &object.Function{Token: node.Token, Parameters: params, Env: env, Body: body, Name: name, Node: node, Lexer: lex, File: lexFile}
 
 		if name != "" {
 			env.Set(name, fn)
@@ -159,7 +322,12 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 			return function
 		}
 
-		args := evalExpressions(node.Arguments, env)
+		var args []object.Object
+		if b, ok := function.(*object.Builtin); ok && b.RawCommands {
+			args = evalRawCommandArguments(node.Arguments, env)
+		} else {
+			args = evalExpressions(node.Arguments, env)
+		}
 
 		// Did we pass arguments as ...?
 		// If so, replace arguments with the
@@ -182,12 +350,35 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return applyFunction(node.Token, function, env, args)
 
 	case *ast.MethodExpression:
-		o := Eval(node.Object, env)
+		// Builtins that run commands on their own
+		// terms get them as written even when called
+		// as methods, as in "echo $x".exec()
+		f, raw := Fns[node.Method.String()]
+		raw = raw && f.RawCommands
+
+		var o object.Object
+		if raw {
+			o = evalRawCommandArguments([]ast.Expression{node.Object}, env)[0]
+		} else {
+			o = Eval(node.Object, env)
+		}
 		if isError(o) {
 			return o
 		}
 
-		args := evalExpressions(node.Arguments, env)
+		// Functions stored in hashes take precedence
+		// over builtins, and their arguments are
+		// evaluated as usual
+		if _, ok := o.(*object.Hash); ok {
+			raw = false
+		}
+
+		var args []object.Object
+		if raw {
+			args = evalRawCommandArguments(node.Arguments, env)
+		} else {
+			args = evalExpressions(node.Arguments, env)
+		}
 		if len(args) == 1 && isError(args[0]) {
 			return args[0]
 		}
@@ -245,11 +436,21 @@ loop:
 		}
 		result = Eval(statement, env)
 
+		// Signals are handled in between
+		// statements, much like bash traps
+		if err := handleSignals(env); err != nil {
+			result = err
+		}
+
 		switch ret := result.(type) {
 		case *object.ReturnValue:
 			result = ret.Value
 			break loop
 		case *object.Error:
+			if !ret.Caught {
+				break loop
+			}
+		case *object.ExitError:
 			break loop
 		}
 	}
@@ -283,9 +484,12 @@ func evalBlockStatement(
 		}
 		result = Eval(statement, env)
 
+		if err := handleSignals(env); err != nil {
+			result = err
+		}
+
 		if result != nil {
-			rt := result.Type()
-			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+			if result.Type() == object.RETURN_VALUE_OBJ || isError(result) {
 				break
 			}
 		}
@@ -389,7 +593,7 @@ func doEvalDecorator(node *ast.Decorator, env *object.Environment) (string, obje
 	switch decorated := node.Decorated.(type) {
 	case *ast.FunctionLiteral:
 		// Here we have a single decorator
-		fn := &object.Function{Token: decorated.Token, Parameters: decorated.Parameters, Env: env, Body: decorated.Body, Name: name, Node: decorated}
+		fn := &object.Function{Token: decorated.Token, Parameters: decorated.Parameters, Env: env, Body: decorated.Body, Name: name, Node: decorated, Lexer: lex, File: lexFile}
 		return name, applyFunction(decorated.Token, decorator, env, []object.Object{fn}), nil
 	case *ast.Decorator:
 		// Here we have a decorator of another decorator
@@ -403,7 +607,7 @@ func doEvalDecorator(node *ast.Decorator, env *object.Environment) (string, obje
 			return "", nil, err
 		}
 
-		return fnName, applyFunction(node.Token, decorator, env, append([]object.Object{fn})), nil
+		return fnName, applyFunction(node.Token, decorator, env, []object.Object{fn}), nil
 	default:
 		return "", nil, newError(node.Token, "a decorator must decorate a named function or another decorator")
 	}
@@ -443,7 +647,7 @@ func evalIndexAssignment(iex *ast.IndexExpression, expr object.Object, env *obje
 		idx := index.(*object.Number).Int()
 		elems := arrayObject.Elements
 		if idx < 0 {
-			return newError(iex.Token, "index out of range: %d", idx)
+			return newKindError(iex.Token, object.INDEX_ERROR, "index out of range: %d", idx)
 		}
 		if idx >= len(elems) {
 			// expand the array by appending Null objects
@@ -459,11 +663,11 @@ func evalIndexAssignment(iex *ast.IndexExpression, expr object.Object, env *obje
 		hashObject := leftObj.(*object.Hash)
 		key, ok := index.(object.Hashable)
 		if !ok {
-			return newError(iex.Token, "unusable as hash key: %s", index.Type())
+			return newKindError(iex.Token, object.TYPE_ERROR, "unusable as hash key: %s", index.Type())
 		}
 		hashed := key.HashKey()
 		pair := object.HashPair{Key: index, Value: expr}
-		hashObject.Pairs[hashed] = pair
+		hashObject.Set(hashed, pair)
 		return NULL
 	}
 	return NULL
@@ -477,7 +681,7 @@ func evalPropertyAssignment(pex *ast.PropertyExpression, expr object.Object, env
 		prop := &object.String{Token: pex.Token, Value: pex.Property.String()}
 		hashed := prop.HashKey()
 		pair := object.HashPair{Key: prop, Value: expr}
-		hashObject.Pairs[hashed] = pair
+		hashObject.Set(hashed, pair)
 		return NULL
 	}
 	return newError(pex.Token, "can only assign to hash property, got %s", leftObj.Type())
@@ -554,7 +758,7 @@ func evalPrefixExpression(tok token.Token, operator string, right object.Object)
 	case "~":
 		return evalTildePrefixOperatorExpression(tok, right)
 	default:
-		return newError(tok, "unknown operator: %s%s", operator, right.Type())
+		return newKindError(tok, object.TYPE_ERROR, "unknown operator: %s%s", operator, right.Type())
 	}
 }
 
@@ -602,7 +806,7 @@ func evalInfixExpression(
 	case left.Type() == object.NUMBER_OBJ && right.Type() == object.NUMBER_OBJ:
 		return evalNumberInfixExpression(tok, operator, left, right)
 	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
-		return evalStringInfixExpression(tok, operator, left, right)
+		return evalStringInfixExpression(tok, operator, left, right, env)
 	case left.Type() == object.ARRAY_OBJ && right.Type() == object.ARRAY_OBJ:
 		return evalArrayInfixExpression(tok, operator, left, right)
 	case left.Type() == object.HASH_OBJ && right.Type() == object.HASH_OBJ:
@@ -616,9 +820,9 @@ func evalInfixExpression(
 	case operator == "!=":
 		return nativeBoolToBooleanObject(left != right)
 	case left.Type() != right.Type():
-		return newError(tok, "type mismatch: %s %s %s", left.Type(), operator, right.Type())
+		return newKindError(tok, object.TYPE_ERROR, "type mismatch: %s %s %s", left.Type(), operator, right.Type())
 	default:
-		return newError(tok, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
+		return newKindError(tok, object.TYPE_ERROR, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
 	}
 }
 
@@ -633,24 +837,30 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 func evalTildePrefixOperatorExpression(tok token.Token, right object.Object) object.Object {
 	switch o := right.(type) {
 	case *object.Number:
-		return &object.Number{Value: float64(^int64(o.Value))}
+		i := o.BigInt()
+		return object.NewBigNumber(tok, i.Not(i))
 	default:
-		return newError(tok, "Bitwise not (~) can only be applied to numbers, got %s (%s)", o.Type(), o.Inspect())
+		return newKindError(tok, object.TYPE_ERROR, "Bitwise not (~) can only be applied to numbers, got %s (%s)", o.Type(), o.Inspect())
 	}
 }
 
 func evalMinusPrefixOperatorExpression(tok token.Token, right object.Object) object.Object {
 	if right.Type() != object.NUMBER_OBJ {
-		return newError(tok, "unknown operator: -%s", right.Type())
+		return newKindError(tok, object.TYPE_ERROR, "unknown operator: -%s", right.Type())
+	}
+
+	n := right.(*object.Number)
+
+	if n.Big != nil {
+		return object.NewBigNumber(tok, new(big.Int).Neg(n.Big))
 	}
 
-	value := right.(*object.Number).Value
-	return &object.Number{Value: -value}
+	return &object.Number{Value: -n.Value}
 }
 
 func evalPlusPrefixOperatorExpression(tok token.Token, right object.Object) object.Object {
 	if right.Type() != object.NUMBER_OBJ {
-		return newError(tok, "unknown operator: +%s", right.Type())
+		return newKindError(tok, object.TYPE_ERROR, "unknown operator: +%s", right.Type())
 	}
 
 	return right
@@ -660,6 +870,12 @@ func evalNumberInfixExpression(
 	tok token.Token, operator string,
 	left, right object.Object,
 ) object.Object {
+	// Integers beyond 2^53 can't be represented exactly
+	// by a float, so we might need arbitrary precision
+	if result, ok := evalBigNumberInfixExpression(tok, operator, left.(*object.Number), right.(*object.Number)); ok {
+		return result
+	}
+
 	leftVal := left.(*object.Number).Value
 	rightVal := right.(*object.Number).Value
 	switch operator {
@@ -728,14 +944,175 @@ func evalNumberInfixExpression(
 
 		return &object.Array{Token: tok, Elements: a}
 	default:
-		return newError(tok, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
+		return newKindError(tok, object.TYPE_ERROR, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
 	}
 }
 
+// evalBigNumberInfixExpression evaluates operations that
+// need arbitrary precision, either because one of the
+// numbers is a big integer or because the result of an
+// integer operation would be one (eg. 2 ** 64).
+// Bitwise operators always work on the integer part of
+// the numbers, so that they don't need to be truncated
+// to 64 bits.
+// If the operation can be carried out with regular
+// floats, we return false.
+func evalBigNumberInfixExpression(tok token.Token, operator string, left, right *object.Number) (object.Object, bool) {
+	isBig := left.Big != nil || right.Big != nil
+	isInt := left.IsInt() && right.IsInt()
+
+	switch operator {
+	case "&", "|", "^", ">>", "<<":
+		l, r := left.BigInt(), right.BigInt()
+
+		switch operator {
+		case "&":
+			l.And(l, r)
+		case "|":
+			l.Or(l, r)
+		case "^":
+			l.Xor(l, r)
+		default:
+			if r.Sign() < 0 || !r.IsUint64() {
+				return newError(tok, "invalid shift amount: %s", right.Inspect()), true
+			}
+
+			if operator == ">>" {
+				l.Rsh(l, uint(r.Uint64()))
+			} else {
+				l.Lsh(l, uint(r.Uint64()))
+			}
+		}
+
+		return object.NewBigNumber(tok, l), true
+	case "~":
+		return nativeBoolToBooleanObject(left.BigInt().Cmp(right.BigInt()) == 0), true
+	case "<", ">", "<=", ">=", "<=>", "==", "!=":
+		if !isBig || math.IsNaN(left.Value) || math.IsNaN(right.Value) {
+			return nil, false
+		}
+
+		cmp := left.BigFloat().Cmp(right.BigFloat())
+
+		switch operator {
+		case "<":
+			return nativeBoolToBooleanObject(cmp < 0), true
+		case ">":
+			return nativeBoolToBooleanObject(cmp > 0), true
+		case "<=":
+			return nativeBoolToBooleanObject(cmp <= 0), true
+		case ">=":
+			return nativeBoolToBooleanObject(cmp >= 0), true
+		case "==":
+			return nativeBoolToBooleanObject(cmp == 0), true
+		case "!=":
+			return nativeBoolToBooleanObject(cmp != 0), true
+		default:
+			return &object.Number{Token: tok, Value: float64(cmp)}, true
+		}
+	}
+
+	// From here onwards, we only deal with
+	// arithmetic between integers
+	if !isInt {
+		return nil, false
+	}
+
+	l, r := left.BigInt(), right.BigInt()
+
+	switch operator {
+	case "+", "-", "*":
+		if !isBig && !exceedsExactInt(left.Value, right.Value, operator) {
+			return nil, false
+		}
+
+		switch operator {
+		case "+":
+			l.Add(l, r)
+		case "-":
+			l.Sub(l, r)
+		default:
+			l.Mul(l, r)
+		}
+
+		return object.NewBigNumber(tok, l), true
+	case "**":
+		// Negative exponents result in floats, while
+		// huge ones would never fit in memory anyway
+		if r.Sign() < 0 || right.Big != nil || (!isBig && !exceedsExactInt(left.Value, right.Value, operator)) {
+			return nil, false
+		}
+
+		return object.NewBigNumber(tok, l.Exp(l, r, nil)), true
+	case "/", "%":
+		// Division by zero follows the rules of floats
+		if !isBig || r.Sign() == 0 {
+			return nil, false
+		}
+
+		q, m := new(big.Int).QuoRem(l, r, new(big.Int))
+
+		if operator == "%" {
+			return object.NewBigNumber(tok, m), true
+		}
+
+		if m.Sign() == 0 {
+			return object.NewBigNumber(tok, q), true
+		}
+
+		f, _ := new(big.Rat).SetFrac(l, r).Float64()
+		return &object.Number{Token: tok, Value: f}, true
+	case "..":
+		if !isBig {
+			return nil, false
+		}
+
+		a := make([]object.Object, 0)
+		step := big.NewInt(1)
+
+		if l.Cmp(r) > 0 {
+			step.Neg(step)
+		}
+
+		for i := l; ; i = new(big.Int).Add(i, step) {
+			a = append(a, object.NewBigNumber(tok, i))
+
+			if i.Cmp(r) == 0 {
+				break
+			}
+		}
+
+		return &object.Array{Token: tok, Elements: a}, true
+	}
+
+	return nil, false
+}
+
+// exceedsExactInt checks whether the result of an
+// operation between 2 floats would go beyond the
+// range of integers they can represent exactly
+func exceedsExactInt(left, right float64, operator string) bool {
+	var result float64
+
+	switch operator {
+	case "+":
+		result = left + right
+	case "-":
+		result = left - right
+	case "*":
+		result = left * right
+	case "**":
+		result = math.Pow(left, right)
+	}
+
+	return math.Abs(result) >= object.MaxExactInt
+}
+
 func evalStringInfixExpression(
 	tok token.Token,
 	operator string,
 	left, right object.Object,
+	env *object.Environment,
 ) object.Object {
 	leftVal := left.(*object.String).Value
 	rightVal := right.(*object.String).Value
@@ -765,6 +1142,10 @@ func evalStringInfixExpression(
 	}
 
 	if operator == ">" {
+		if dryRunFile(env, "write %d bytes to %s", len(leftVal), rightVal) {
+			return &object.Boolean{Token: tok, Value: true}
+		}
+
 		err := writeFile(rightVal, leftVal)
 
 		if err != nil {
@@ -775,6 +1156,10 @@ func evalStringInfixExpression(
 	}
 
 	if operator == ">>" {
+		if dryRunFile(env, "append %d bytes to %s", len(leftVal), rightVal) {
+			return &object.Boolean{Token: tok, Value: true}
+		}
+
 		err := appendFile(rightVal, leftVal)
 
 		if err != nil {
@@ -784,7 +1169,7 @@ func evalStringInfixExpression(
 		return &object.Boolean{Token: tok, Value: true}
 	}
 
-	return newError(tok, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	return newKindError(tok, object.TYPE_ERROR, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
 }
 
 func writeFile(file string, content string) error {
@@ -816,7 +1201,7 @@ func evalArrayInfixExpression(
 		return &object.Array{Token: tok, Elements: append(leftVal, rightVal...)}
 	}
 
-	return newError(tok, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	return newKindError(tok, object.TYPE_ERROR, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
 }
 
 func evalHashInfixExpression(
@@ -827,17 +1212,15 @@ func evalHashInfixExpression(
 	leftHashObject := left.(*object.Hash)
 	rightHashObject := right.(*object.Hash)
 	if operator == "+" {
-		leftVal := leftHashObject.Pairs
-		rightVal := rightHashObject.Pairs
-		for _, rightPair := range rightVal {
+		for _, rightPair := range rightHashObject.OrderedPairs() {
 			key := rightPair.Key
 			hashed := key.(object.Hashable).HashKey()
-			leftVal[hashed] = object.HashPair{Key: key, Value: rightPair.Value}
+			leftHashObject.Set(hashed, object.HashPair{Key: key, Value: rightPair.Value})
 		}
-		return &object.Hash{Token: tok, Pairs: leftVal}
+		return leftHashObject
 	}
 
-	return newError(tok, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	return newKindError(tok, object.TYPE_ERROR, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
 }
 
 func evalInExpression(tok token.Token, left, right object.Object) object.Object {
@@ -871,12 +1254,11 @@ func evalInExpression(tok token.Token, left, right object.Object) object.Object
 			found = strings.Contains(right.Inspect(), left.Inspect())
 		}
 	case *object.Hash:
-		if left.Type() == object.STRING_OBJ {
-			_, ok := rightObj.GetPair(left.(*object.String).Value)
-			found = ok
+		if key, ok := left.(object.Hashable); ok {
+			_, found = rightObj.Pairs[key.HashKey()]
 		}
 	default:
-		return newError(tok, "'in' operator not supported on %s", right.Type())
+		return newKindError(tok, object.TYPE_ERROR, "'in' operator not supported on %s", right.Type())
 	}
 
 	return &object.Boolean{Token: tok, Value: found}
@@ -964,7 +1346,7 @@ func evalLoop(condition ast.Expression, env *object.Environment, block *ast.Bloc
 					return NULL
 				case *object.ContinueError:
 
-				case *object.Error:
+				default:
 					return res
 				}
 			}
@@ -1025,6 +1407,30 @@ func evalForInExpression(
 		}()
 
 		return loopIterable(i.Next, env, fie, 0)
+	case *object.String:
+		// Only streamed commands can be
+		// iterated over, line by line
+		if i.Lines == nil {
+			return newKindError(fie.Token, object.TYPE_ERROR, "'%s' is a %s, not an iterable, cannot be used in for loop", i.Inspect(), i.Type())
+		}
+
+		pending := i.Ok == nil
+		res := loopIterable(func() (object.Object, object.Object) {
+			// Other goroutines can go on while
+			// we wait for the next line
+			resume := yield()
+			defer resume()
+
+			return i.NextLine()
+		}, env, fie, 0)
+
+		// A streamed command is waited for once
+		// the loop reads the end of its output
+		if !isError(res) && pending && failsStrictly(env, i) {
+			return newCommandError(i)
+		}
+
+		return res
 	case *object.Builtin:
 		if i.Next == nil {
 			return newError(fie.Token, "builtin function cannot be used in loop")
@@ -1032,7 +1438,7 @@ func evalForInExpression(
 
 		return loopIterable(i.Next, env, fie, 0)
 	default:
-		return newError(fie.Token, "'%s' is a %s, not an iterable, cannot be used in for loop", i.Inspect(), i.Type())
+		return newKindError(fie.Token, object.TYPE_ERROR, "'%s' is a %s, not an iterable, cannot be used in for loop", i.Inspect(), i.Type())
 	}
 }
 
@@ -1063,7 +1469,7 @@ func loopIterable(next func() (object.Object, object.Object), env *object.Enviro
 				return NULL
 			case *object.ContinueError:
 
-			case *object.Error:
+			default:
 				return res
 			}
 		}
@@ -1094,6 +1500,265 @@ func loopIterable(next func() (object.Object, object.Object), env *object.Enviro
 	return NULL
 }
 
+// try {...} catch err {...} finally {...}
+func evalTryExpression(
+	te *ast.TryExpression,
+	env *object.Environment,
+) object.Object {
+	result := Eval(te.Block, env)
+
+	// We only want to catch actual errors:
+	// break and continue also travel as errors
+	// but they need to reach their own loop.
+	if err, ok := result.(*object.Error); ok && !err.Caught && te.Catch != nil {
+		result = evalCatchBlock(te, err, env)
+	}
+
+	// The finally block always runs, but
+	// whatever it produces is discarded unless
+	// it's a return or another error: those
+	// take precedence over the result of the
+	// try...catch.
+	if te.Finally != nil {
+		res := Eval(te.Finally, env)
+
+		if res != nil && (res.Type() == object.RETURN_VALUE_OBJ || isError(res)) {
+			return res
+		}
+	}
+
+	return result
+}
+
+// Runs the catch block of a try...catch, binding
+// the error to the given identifier for the duration
+// of the block.
+func evalCatchBlock(te *ast.TryExpression, err *object.Error, env *object.Environment) object.Object {
+	if te.Identifier == "" {
+		return Eval(te.Catch, env)
+	}
+
+	// If the identifier was already declared,
+	// let's keep it aside so that we can restore
+	// it once we're out of the catch block
+	existingIdentifier, identifierExisted := env.Get(te.Identifier)
+
+	defer func() {
+		if identifierExisted {
+			env.Set(te.Identifier, existingIdentifier)
+		} else {
+			env.Delete(te.Identifier)
+		}
+	}()
+
+	caught := *err
+	caught.Caught = true
+	env.Set(te.Identifier, &caught)
+
+	return Eval(te.Catch, env)
+}
+
+// throw "something went wrong"
+//
+// Throwing an error that was previously
+// caught re-raises it, anything else is
+// converted to an error.
+func evalThrow(tok token.Token, val object.Object) object.Object {
+	switch v := val.(type) {
+	case *object.Error:
+		thrown := *v
+		thrown.Caught = false
+		return &thrown
+	case *object.String:
+		return newError(tok, "%s", v.Value)
+	default:
+		return newError(tok, "%s", val.Inspect())
+	}
+}
+
+// match x { 1 => "one", [a, b] if a > b => a, _ => "other" }
+//
+// Arms are evaluated in order, and the first one
+// that matches wins. Identifiers within a pattern
+// are bound to the matched values, the same way
+// destructuring assignments (a, b = [1, 2]) work.
+// If no arm matches, we return null.
+func evalMatchExpression(me *ast.MatchExpression, env *object.Environment) object.Object {
+	value := Eval(me.Value, env)
+	if isError(value) {
+		return value
+	}
+
+	for _, arm := range me.Arms {
+		bindings := map[string]object.Object{}
+		matched, err := matchPattern(arm.Pattern, value, bindings, env)
+
+		if err != nil {
+			return err
+		}
+
+		if !matched {
+			continue
+		}
+
+		// The identifiers bound by the pattern are only
+		// available within the arm, in its guard and body:
+		// once we're done with the arm we restore the ones
+		// they shadowed, just like for loops do
+		restore := bindIdentifiers(bindings, env)
+
+		if arm.Guard != nil {
+			guard := Eval(arm.Guard, env)
+
+			if isError(guard) {
+				restore()
+				return guard
+			}
+
+			if !isTruthy(guard) {
+				restore()
+				continue
+			}
+		}
+
+		result := Eval(arm.Body, env)
+		restore()
+
+		return result
+	}
+
+	return NULL
+}
+
+// bindIdentifiers sets the given identifiers, returning
+// a function that restores the ones they shadowed, or
+// deletes them if they weren't declared before.
+func bindIdentifiers(bindings map[string]object.Object, env *object.Environment) func() {
+	existing := map[string]object.Object{}
+
+	for name, v := range bindings {
+		if old, ok := env.Get(name); ok {
+			existing[name] = old
+		}
+
+		env.Set(name, v)
+	}
+
+	return func() {
+		for name := range bindings {
+			if old, ok := existing[name]; ok {
+				env.Set(name, old)
+			} else {
+				env.Delete(name)
+			}
+		}
+	}
+}
+
+// matchPattern checks whether the value matches the given
+// pattern, collecting the identifiers it binds along the way:
+//
+// _          matches anything
+// x          matches anything, and binds it to x
+// 1..10      matches numbers within the range
+// [a, 2]     matches arrays with 2 elements, the second being 2
+// {"a": x}   matches hashes with an "a" key
+// "abc"      matches values equal to the literal
+func matchPattern(pattern ast.Expression, value object.Object, bindings map[string]object.Object, env *object.Environment) (bool, object.Object) {
+	switch p := pattern.(type) {
+	case *ast.Identifier:
+		if p.Value != "_" {
+			bindings[p.Value] = value
+		}
+
+		return true, nil
+	case *ast.ArrayLiteral:
+		arr, ok := value.(*object.Array)
+
+		if !ok || len(arr.Elements) != len(p.Elements) {
+			return false, nil
+		}
+
+		for i, element := range p.Elements {
+			matched, err := matchPattern(element, arr.Elements[i], bindings, env)
+
+			if err != nil || !matched {
+				return false, err
+			}
+		}
+
+		return true, nil
+	case *ast.HashLiteral:
+		hash, ok := value.(*object.Hash)
+
+		if !ok {
+			return false, nil
+		}
+
+		for _, keyNode := range p.Keys {
+			valueNode := p.Pairs[keyNode]
+			key := Eval(keyNode, env)
+			if isError(key) {
+				return false, key
+			}
+
+			hashKey, ok := key.(object.Hashable)
+			if !ok {
+				return false, newKindError(p.Token, object.TYPE_ERROR, "unusable as hash key: %s", key.Type())
+			}
+
+			pair, ok := hash.Pairs[hashKey.HashKey()]
+			if !ok {
+				return false, nil
+			}
+
+			matched, err := matchPattern(valueNode, pair.Value, bindings, env)
+
+			if err != nil || !matched {
+				return false, err
+			}
+		}
+
+		return true, nil
+	case *ast.InfixExpression:
+		if p.Operator == ".." {
+			return matchRange(p, value, env)
+		}
+	}
+
+	expected := Eval(pattern, env)
+	if isError(expected) {
+		return false, expected
+	}
+
+	return object.Equal(expected, value), nil
+}
+
+// 1..10 matches any number between 1 and 10, inclusive
+func matchRange(p *ast.InfixExpression, value object.Object, env *object.Environment) (bool, object.Object) {
+	n, ok := value.(*object.Number)
+	if !ok {
+		return false, nil
+	}
+
+	bounds := []float64{}
+	for _, node := range []ast.Expression{p.Left, p.Right} {
+		bound := Eval(node, env)
+		if isError(bound) {
+			return false, bound
+		}
+
+		b, ok := bound.(*object.Number)
+		if !ok {
+			return false, newKindError(p.Token, object.TYPE_ERROR, "range patterns can only be numerical: got %s (type %s)", bound.Inspect(), bound.Type())
+		}
+
+		bounds = append(bounds, b.Value)
+	}
+
+	return n.Value >= bounds[0] && n.Value <= bounds[1], nil
+}
+
 func evalIdentifier(
 	node *ast.Identifier,
 	env *object.Environment,
@@ -1106,7 +1771,15 @@ func evalIdentifier(
 		return builtin
 	}
 
-	return newError(node.Token, "identifier not found: %s", node.Value)
+	// Modules are handed out as a new hash every
+	// time, so that assigning to one, as in
+	// p = path; p.join = ..., doesn't change
+	// the module for the rest of the script
+	if module, ok := Modules[node.Value]; ok {
+		return builtinModule(node.Token, module)
+	}
+
+	return newKindError(node.Token, object.NAME_ERROR, "identifier not found: %s", node.Value)
 }
 
 // This is the core of ABS's logical
@@ -1141,6 +1814,13 @@ func isTruthy(obj object.Object) bool {
 
 func isError(obj object.Object) bool {
 	if obj != nil {
+		// Errors that have been caught are
+		// regular values, they shouldn't stop
+		// the execution of the program
+		if err, ok := obj.(*object.Error); ok && err.Caught {
+			return false
+		}
+
 		return obj.Type() == object.ERROR_OBJ
 	}
 	return false
@@ -1163,6 +1843,63 @@ func evalExpressions(
 	return result
 }
 
+// Evaluates the arguments of builtin functions
+// that run commands on their own terms: commands
+// (`cmd`) are prepared but not run, so that the
+// function can decide how to run them.
+//
+// String literals are not interpolated either,
+// so that their $vars can be quoted when they
+// are interpolated into the command.
+//
+// Commands within array literals, such as
+// fn([`cmd1`, `cmd2`]), are not run as well.
+func evalRawCommandArguments(
+	exps []ast.Expression,
+	env *object.Environment,
+) []object.Object {
+	var result []object.Object
+
+	for _, e := range exps {
+		switch c := e.(type) {
+		case *ast.CommandExpression:
+			s, _ := prepareCommand(c.Token, c.Value, env)
+			result = append(result, s)
+			continue
+		case *ast.StringLiteral:
+			result = append(result, &object.String{Token: c.Token, Value: c.Value})
+			continue
+		case *ast.ArrayLiteral:
+			elements := []object.Object{}
+
+			for _, element := range c.Elements {
+				if cmd, ok := element.(*ast.CommandExpression); ok {
+					s, _ := prepareCommand(cmd.Token, cmd.Value, env)
+					elements = append(elements, s)
+					continue
+				}
+
+				evaluated := Eval(element, env)
+				if isError(evaluated) {
+					return []object.Object{evaluated}
+				}
+				elements = append(elements, evaluated)
+			}
+
+			result = append(result, &object.Array{Token: c.Token, Elements: elements})
+			continue
+		}
+
+		evaluated := Eval(e, env)
+		if isError(evaluated) {
+			return []object.Object{evaluated}
+		}
+		result = append(result, evaluated)
+	}
+
+	return result
+}
+
 // Property expression (x.y) evaluator.
 //
 // Here we have a special case, as strings
@@ -1182,24 +1919,18 @@ func evalPropertyExpression(pe *ast.PropertyExpression, env *object.Environment)
 
 	switch obj := o.(type) {
 	case *object.String:
-		// Special .ok property of commands
-		if pe.Property.String() == "ok" {
-			if obj.Ok != nil {
-				return obj.Ok
-			}
-
-			return FALSE
-		}
-		// Special .done property of commands
-		if pe.Property.String() == "done" {
-			if obj.Done != nil {
-				return obj.Done
-			}
-
-			return FALSE
+		if property := evalCommandProperty(pe.Token, obj, pe.Property.String()); property != nil {
+			return property
 		}
 	case *object.Hash:
-		return evalHashIndexExpression(obj.Token, obj, &object.String{Token: pe.Token, Value: pe.Property.String()})
+		// h?.key is null, rather than an error,
+		// when the key is missing in strict mode
+		strict := env.Settings.Strict && !pe.Optional
+		return evalHashIndexExpression(pe.Token, obj, &object.String{Token: pe.Token, Value: pe.Property.String()}, strict)
+	case *object.Error:
+		if property := evalErrorProperty(pe.Token, obj, pe.Property.String()); property != nil {
+			return property
+		}
 	}
 
 	if pe.Optional {
@@ -1209,23 +1940,170 @@ func evalPropertyExpression(pe *ast.PropertyExpression, env *object.Environment)
 	return newError(pe.Token, "invalid property '%s' on type %s", pe.Property.String(), o.Type())
 }
 
+// Commands expose their result as properties:
+// cmd.ok, cmd.exit_code, cmd.stdout and so on.
+// Until a background command is done, its result
+// is not available and these properties are null.
+func evalCommandProperty(tok token.Token, s *object.String, property string) object.Object {
+	running := s.Running()
+	done := !running && s.Cmd != nil && s.Done != nil && s.Done.Value
+
+	switch property {
+	case "ok":
+		if !running && s.Ok != nil {
+			return s.Ok
+		}
+
+		return FALSE
+	case "done":
+		if !running && s.Done != nil {
+			return s.Done
+		}
+
+		return FALSE
+	case "command":
+		if s.Cmd == nil {
+			return NULL
+		}
+
+		return &object.String{Token: tok, Value: s.Command}
+	case "pid":
+		if s.Cmd == nil || s.Cmd.Process == nil {
+			return NULL
+		}
+
+		return &object.Number{Token: tok, Value: float64(s.Cmd.Process.Pid)}
+	case "exit_code":
+		if !done {
+			return NULL
+		}
+
+		return &object.Number{Token: tok, Value: float64(s.ExitCode)}
+	case "stdout":
+		if !done {
+			return NULL
+		}
+
+		return &object.String{Token: tok, Value: s.Stdout.String()}
+	case "stderr":
+		if !done {
+			return NULL
+		}
+
+		return &object.String{Token: tok, Value: s.Stderr.String()}
+	case "timed_out":
+		if !done {
+			return NULL
+		}
+
+		return nativeBoolToBooleanObject(s.TimedOut)
+	case "duration":
+		if !done {
+			return NULL
+		}
+
+		// in milliseconds, such as 12.5
+		return &object.Number{Token: tok, Value: float64(s.Duration) / float64(time.Millisecond)}
+	}
+
+	return nil
+}
+
+// Errors expose their details as properties:
+// err.message, err.kind, err.line and so on
+func evalErrorProperty(tok token.Token, err *object.Error, property string) object.Object {
+	switch property {
+	case "message":
+		return &object.String{Token: tok, Value: err.Message}
+	case "kind":
+		return &object.String{Token: tok, Value: err.Kind}
+	case "line":
+		return &object.Number{Token: tok, Value: float64(err.Line)}
+	case "column":
+		return &object.Number{Token: tok, Value: float64(err.Column)}
+	case "file":
+		return &object.String{Token: tok, Value: err.File}
+	case "command", "stderr", "exit_code":
+		// Only errors raised by failing
+		// commands have these properties
+		if err.Cmd == nil {
+			return NULL
+		}
+
+		return evalCommandProperty(tok, err.Cmd, property)
+	case "stack":
+		stack := &object.Array{Token: tok}
+
+		for _, frame := range err.Stack {
+			stack.Elements = append(stack.Elements, frameToHash(tok, frame))
+		}
+
+		return stack
+	}
+
+	return nil
+}
+
+// frameToHash converts a stack frame to an hash such as
+// {"function": "fn", "file": "script.abs", "line": 1, "column": 5, "code": "fn()"}
+func frameToHash(tok token.Token, frame object.Frame) *object.Hash {
+	return object.NewHashFromPairs(tok, []object.HashPair{
+		{Key: &object.String{Token: tok, Value: "function"}, Value: &object.String{Token: tok, Value: frame.Function}},
+		{Key: &object.String{Token: tok, Value: "file"}, Value: &object.String{Token: tok, Value: frame.File}},
+		{Key: &object.String{Token: tok, Value: "line"}, Value: &object.Number{Token: tok, Value: float64(frame.Line)}},
+		{Key: &object.String{Token: tok, Value: "column"}, Value: &object.Number{Token: tok, Value: float64(frame.Column)}},
+		{Key: &object.String{Token: tok, Value: "code"}, Value: &object.String{Token: tok, Value: frame.Code}},
+	})
+}
+
 func applyFunction(tok token.Token, fn object.Object, env *object.Environment, args []object.Object) object.Object {
 	switch fn := fn.(type) {
 	case *object.Function:
+		traceCall(env, tok, "-> %s(%s)", functionName(fn), traceArguments(args))
+
+		// Keep track of the call and, while we're
+		// in the function's body, locate errors
+		// within the file it was defined in
+		callStack = append(callStack, call{function: functionName(fn), tok: tok, lex: lex, file: lexFile})
+		savedLexer, savedFile := lex, lexFile
+		if fn.Lexer != nil {
+			lex, lexFile = fn.Lexer, fn.File
+		}
+
+		var result object.Object
+		defer func() {
+			lex, lexFile = savedLexer, savedFile
+			callStack = callStack[:len(callStack)-1]
+			traceCall(env, tok, "<- %s: %s", functionName(fn), traceValue(result))
+		}()
+
 		extendedEnv, err := extendFunctionEnv(fn, args)
 
 		if err != nil {
+			result = err
 			return err
 		}
 		evaluated := Eval(fn.Body, extendedEnv)
-		return unwrapReturnValue(evaluated)
+		extendedEnv.RunDeferred()
+		result = unwrapReturnValue(evaluated)
+		return result
 
 	case *object.Builtin:
 		return fn.Fn(tok, env, args...)
 
 	default:
-		return newError(tok, "not a function: %s", fn.Type())
+		return newKindError(tok, object.TYPE_ERROR, "not a function: %s", fn.Type())
+	}
+}
+
+// functionName returns the name used to refer
+// to the function in stack traces
+func functionName(fn *object.Function) string {
+	if fn.Name == "" {
+		return "<anonymous>"
 	}
+
+	return fn.Name
 }
 
 func applyMethod(tok token.Token, o object.Object, me *ast.MethodExpression, env *object.Environment, args []object.Object) object.Object {
@@ -1235,9 +2113,10 @@ func applyMethod(tok token.Token, o object.Object, me *ast.MethodExpression, env
 	hash, isHash := o.(*object.Hash)
 
 	// If so, run the user-defined function
-	if isHash && hash.GetKeyType(method) == object.FUNCTION_OBJ {
+	// (or the builtin one, as in path.join(...))
+	if isHash && (hash.GetKeyType(method) == object.FUNCTION_OBJ || hash.GetKeyType(method) == object.BUILTIN_OBJ) {
 		pair, _ := hash.GetPair(method)
-		return applyFunction(tok, pair.Value.(*object.Function), env, args)
+		return applyFunction(tok, pair.Value, env, args)
 	}
 
 	// Now, check if there is a builtin function with the given name
@@ -1248,12 +2127,12 @@ func applyMethod(tok token.Token, o object.Object, me *ast.MethodExpression, env
 			return NULL
 		}
 
-		return newError(tok, "%s does not have method '%s()'", o.Type(), method)
+		return newKindError(tok, object.TYPE_ERROR, "%s does not have method '%s()'", o.Type(), method)
 	}
 
 	// Make sure the builtin function can be called on the given type
 	if !CanCallMethod(f, o) {
-		return newError(tok, "cannot call method '%s()' on '%s'", method, o.Type())
+		return newKindError(tok, object.TYPE_ERROR, "cannot call method '%s()' on '%s'", method, o.Type())
 	}
 
 	// Magic!
@@ -1279,7 +2158,7 @@ func extendFunctionEnv(
 		argumentPassed := len(args) > paramIdx
 
 		if !argumentPassed && param.Default == nil {
-			return nil, newError(fn.Token, "argument %s to function %s is missing, and doesn't have a default value", param.Value, fn.Inspect())
+			return nil, newKindError(fn.Token, object.ARGUMENT_ERROR, "argument %s to function %s is missing, and doesn't have a default value", param.Value, fn.Inspect())
 		}
 
 		var arg object.Object
@@ -1318,15 +2197,17 @@ func evalIndexExpression(node *ast.IndexExpression, env *object.Environment) obj
 		return end
 	}
 
+	_, hashable := index.(object.Hashable)
+
 	switch {
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.NUMBER_OBJ:
 		return evalArrayIndexExpression(tok, left, index, end, node.IsRange)
-	case left.Type() == object.HASH_OBJ && index.Type() == object.STRING_OBJ:
-		return evalHashIndexExpression(tok, left, index)
+	case left.Type() == object.HASH_OBJ && hashable:
+		return evalHashIndexExpression(tok, left, index, env.Settings.Strict)
 	case left.Type() == object.STRING_OBJ && index.Type() == object.NUMBER_OBJ:
 		return evalStringIndexExpression(tok, left, index, end, node.IsRange)
 	default:
-		return newError(tok, "index operator not supported: %s on %s", index.Inspect(), left.Type())
+		return newKindError(tok, object.TYPE_ERROR, "index operator not supported: %s on %s", index.Inspect(), left.Type())
 	}
 }
 
@@ -1359,7 +2240,7 @@ func evalStringIndexExpression(tok token.Token, array, index object.Object, end
 		} else if end != NULL {
 			// if the end index is not a number nor null, then we have an error
 			// (null would mean no end, so it's valid)
-			return newError(tok, `index ranges can only be numerical: got "%s" (type %s)`, end.Inspect(), end.Type())
+			return newKindError(tok, object.TYPE_ERROR, `index ranges can only be numerical: got "%s" (type %s)`, end.Inspect(), end.Type())
 		}
 
 		// if the start is higher than the end, let's return
@@ -1418,7 +2299,7 @@ func evalArrayIndexExpression(tok token.Token, array, index object.Object, end o
 		} else if end != NULL {
 			// if the end index is not a number nor null, then we have an error
 			// (null would mean no end, so it's valid)
-			return newError(tok, `index ranges can only be numerical: got "%s" (type %s)`, end.Inspect(), end.Type())
+			return newKindError(tok, object.TYPE_ERROR, `index ranges can only be numerical: got "%s" (type %s)`, end.Inspect(), end.Type())
 		}
 
 		// if the start is higher than the end, let's return
@@ -1456,9 +2337,10 @@ func evalHashLiteral(
 	node *ast.HashLiteral,
 	env *object.Environment,
 ) object.Object {
-	pairs := make(map[object.HashKey]object.HashPair)
+	hash := &object.Hash{Pairs: make(map[object.HashKey]object.HashPair)}
 
-	for keyNode, valueNode := range node.Pairs {
+	for _, keyNode := range node.Keys {
+		valueNode := node.Pairs[keyNode]
 		key := Eval(keyNode, env)
 		if isError(key) {
 			return key
@@ -1466,7 +2348,7 @@ func evalHashLiteral(
 
 		hashKey, ok := key.(object.Hashable)
 		if !ok {
-			return newError(node.Token, "unusable as hash key: %s", key.Type())
+			return newKindError(node.Token, object.TYPE_ERROR, "unusable as hash key: %s", key.Type())
 		}
 
 		value := Eval(valueNode, env)
@@ -1475,22 +2357,29 @@ func evalHashLiteral(
 		}
 
 		hashed := hashKey.HashKey()
-		pairs[hashed] = object.HashPair{Key: key, Value: value}
+		hash.Set(hashed, object.HashPair{Key: key, Value: value})
 	}
 
-	return &object.Hash{Pairs: pairs}
+	return hash
 }
 
-func evalHashIndexExpression(tok token.Token, hash, index object.Object) object.Object {
+// In strict mode, accessing a key that
+// doesn't exist raises an error rather
+// than returning null.
+func evalHashIndexExpression(tok token.Token, hash, index object.Object, strict bool) object.Object {
 	hashObject := hash.(*object.Hash)
 
 	key, ok := index.(object.Hashable)
 	if !ok {
-		return newError(tok, "unusable as hash key: %s", index.Type())
+		return newKindError(tok, object.TYPE_ERROR, "unusable as hash key: %s", index.Type())
 	}
 
 	pair, ok := hashObject.Pairs[key.HashKey()]
 	if !ok {
+		if strict {
+			return newKindError(tok, object.KEY_ERROR, "key %s not found in hash", index.Json())
+		}
+
 		return NULL
 	}
 
@@ -1498,36 +2387,20 @@ func evalHashIndexExpression(tok token.Token, hash, index object.Object) object.
 }
 
 func evalCommandExpression(tok token.Token, cmd string, env *object.Environment) object.Object {
-	cmd = strings.Trim(cmd, " ")
-
-	// interpolate any $vars in the cmd string
-	cmd = util.InterpolateStringVars(cmd, env)
-
-	// A background command ends with a '&'
-	background := len(cmd) > 1 && cmd[len(cmd)-1] == '&'
-	// If this is a background command
-	// we'll remove the trailing '&' and
-	// execute it in background ourselves
-	if background {
-		cmd = cmd[:len(cmd)-2]
-	}
-
 	// The string holding the command
-	s := &object.String{}
+	s, background := prepareCommand(tok, cmd, env)
+	traceCommand(env, s)
 
-	parts := strings.Split(os.Getenv("ABS_COMMAND_EXECUTOR"), " ")
-	c := exec.Command(parts[0], append(parts[1:], cmd)...)
-	c.Env = os.Environ()
-	c.Stdin = env.Stdio.Stdin
-	var stdout bytes.Buffer
-	var stderr bytes.Buffer
-	c.Stdout = &stdout
-	c.Stderr = &stderr
+	return runCommand(s, background, env)
+}
 
-	s.Stdout = &stdout
-	s.Stderr = &stderr
-	s.Cmd = c
-	s.Token = tok
+// runCommand runs a command prepared through
+// prepareCommand, either waiting for it or
+// leaving it running in background.
+func runCommand(s *object.String, background bool, env *object.Environment) object.Object {
+	if dryRun(env, s) {
+		return s
+	}
 
 	var err error
 	if background {
@@ -1536,15 +2409,23 @@ func evalCommandExpression(tok token.Token, cmd string, env *object.Environment)
 		// wait for it by calling s.Wait().
 		s.SetRunning()
 
-		err := c.Start()
+		// Background commands run in their own process
+		// group, so that signals reach their children too
+		object.SetProcessGroup(s.Cmd)
+
+		err := s.StartCmd()
 		if err != nil {
 			s.SetCmdResult(FALSE)
+			s.SetDone()
 			return FALSE
 		}
 
+		env.Jobs.Add(s.Command, s)
 		go evalCommandInBackground(s)
 	} else {
-		err = c.Run()
+		resume := yield()
+		err = s.RunCmd()
+		resume()
 	}
 
 	if !background {
@@ -1555,9 +2436,153 @@ func evalCommandExpression(tok token.Token, cmd string, env *object.Environment)
 		}
 	}
 
+	// In strict mode, failing commands
+	// stop the script
+	if !background && failsStrictly(env, s) {
+		return newCommandError(s)
+	}
+
 	return s
 }
 
+// handleSignals runs the functions registered through
+// on_signal(...) for the signals received while the
+// last statement was running. If one of them raises
+// an error, or exits, the script stops right there.
+func handleSignals(env *object.Environment) object.Object {
+	for {
+		trap, ok := env.Traps.Received()
+		if !ok {
+			return nil
+		}
+
+		result := applyFunction(trap.Token, trap.Handler, env, []object.Object{&object.String{Token: trap.Token, Value: trap.Signal}})
+		if isError(result) {
+			return result
+		}
+	}
+}
+
+// AtExit runs the functions registered through
+// at_exit(...), as the script is about to exit.
+// Errors raised by them are printed, but don't
+// stop the others from running.
+func AtExit(env *object.Environment) {
+	for _, trap := range env.Traps.Exiting() {
+		if trap.Fn != nil {
+			trap.Fn()
+			continue
+		}
+
+		result := applyFunction(trap.Token, trap.Handler, env, []object.Object{})
+
+		if err, ok := result.(*object.Error); ok && !err.Caught {
+			fmt.Fprintln(env.Stdio.Stdout, err.Inspect())
+		}
+	}
+}
+
+// dryRun tells whether the command should be
+// printed rather than run, as in dry-run mode
+// (abs --dry-run), in which case the command
+// succeeds without any output. Commands can be
+// marked as safe to run anyway, such as
+// run(`git status`, {"safe": true}).
+func dryRun(env *object.Environment, s *object.String) bool {
+	if !env.Settings.DryRun || s.Safe {
+		return false
+	}
+
+	fmt.Fprintf(env.Stdio.Stderr, "[dry-run] $ %s\n", s.Command)
+	s.SetDryRun()
+	return true
+}
+
+// dryRunFile tells whether a change to the filesystem,
+// such as writing to a file, should be printed rather
+// than carried out, as in dry-run mode.
+func dryRunFile(env *object.Environment, format string, a ...interface{}) bool {
+	if !env.Settings.DryRun {
+		return false
+	}
+
+	fmt.Fprintf(env.Stdio.Stderr, "[dry-run] "+format+"\n", a...)
+	return true
+}
+
+// failsStrictly returns whether a command
+// that was waited for should stop the script:
+// in strict mode, failing commands do.
+func failsStrictly(env *object.Environment, s *object.String) bool {
+	return env.Settings.Strict && s.Ok == FALSE
+}
+
+// newCommandError creates the error raised
+// when a command fails in strict mode:
+// it carries the command itself, so that
+// its stderr and exit code are available.
+func newCommandError(s *object.String) *object.Error {
+	message := fmt.Sprintf("command `%s` failed with exit code %d", s.Command, s.ExitCode)
+
+	if stderr := strings.TrimSpace(s.Stderr.String()); stderr != "" {
+		message += ": " + stderr
+	}
+
+	err := newKindError(s.Token, object.COMMAND_ERROR, "%s", message)
+	err.Cmd = s
+	return err
+}
+
+// prepareCommand creates the string holding a
+// command, without running it. It also tells
+// whether the command should run in background
+// (`cmd &`).
+func prepareCommand(tok token.Token, cmd string, env *object.Environment) (*object.String, bool) {
+	cmd = strings.Trim(cmd, " ")
+
+	// interpolate any $vars in the cmd string,
+	// quoting them so that they are not
+	// interpreted by the shell
+	cmd = util.InterpolateCommandVars(cmd, env)
+
+	// A background command ends with a '&'
+	background := len(cmd) > 1 && cmd[len(cmd)-1] == '&'
+	// If this is a background command
+	// we'll remove the trailing '&' and
+	// execute it in background ourselves
+	if background {
+		cmd = cmd[:len(cmd)-2]
+	}
+
+	parts := strings.Split(os.Getenv("ABS_COMMAND_EXECUTOR"), " ")
+	c := exec.Command(parts[0], append(parts[1:], cmd)...)
+	c.Env = os.Environ()
+	c.Stdin = env.Stdio.Stdin
+
+	s := newCommand(tok, c)
+	s.Command = cmd
+	s.Detached = background
+
+	return s, background
+}
+
+// newCommand creates the string that holds the
+// result of a command, capturing its output.
+func newCommand(tok token.Token, c *exec.Cmd) *object.String {
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	c.Stdout = &stdout
+	c.Stderr = &stderr
+
+	return &object.String{
+		Token:   tok,
+		Cmd:     c,
+		Stdout:  &stdout,
+		Stderr:  &stderr,
+		Started: time.Now(),
+	}
+}
+
 // Runs a background command.
 // We will start it, set its result
 // and then mark it as done, so that
@@ -1565,7 +2590,7 @@ func evalCommandExpression(tok token.Token, cmd string, env *object.Environment)
 func evalCommandInBackground(s *object.String) {
 	defer s.SetDone()
 
-	err := s.Cmd.Wait()
+	err := s.WaitCmd()
 
 	if err != nil {
 		s.SetCmdResult(FALSE)
@@ -1574,3 +2599,80 @@ func evalCommandInBackground(s *object.String) {
 
 	s.SetCmdResult(TRUE)
 }
+
+// traceStatement writes the statement about to be
+// run to the trace of the script, if enabled
+// (abs --trace), in the form:
+//
+// + script.abs:3: x = 1
+//
+// with one + for each function call we're in.
+// Only the first line of statements spanning
+// multiple lines, such as functions, is written.
+func traceStatement(env *object.Environment, tok token.Token, node ast.Spannable) {
+	if env.Settings.Trace == nil {
+		return
+	}
+
+	begin, end := node.Span()
+	_, column, line := lex.ErrorLine(begin)
+	code := []rune(line)[column-1:]
+	if len(code) > end-begin {
+		code = code[:end-begin]
+	}
+
+	traceCall(env, tok, "%s", strings.TrimSuffix(strings.TrimSpace(string(code)), ";"))
+}
+
+// traceCommand writes the command about to be run,
+// after its variables have been interpolated, to
+// the trace of the script:
+//
+// + script.abs:3: $ ls -la 'my dir'
+func traceCommand(env *object.Environment, s *object.String) {
+	traceCall(env, s.Token, "$ %s", s.Command)
+}
+
+// traceCall writes a line to the trace of the
+// script, if enabled, prefixed by where the
+// token is.
+func traceCall(env *object.Environment, tok token.Token, format string, a ...interface{}) {
+	if env.Settings.Trace == nil {
+		return
+	}
+
+	line, _, _ := lex.ErrorLine(tok.Position)
+	location := strconv.Itoa(line)
+	if lexFile != "" {
+		location = lexFile + ":" + location
+	}
+
+	fmt.Fprintf(env.Settings.Trace, "%s %s: %s\n", strings.Repeat("+", len(callStack)+1), location, fmt.Sprintf(format, a...))
+}
+
+// traceArguments formats the arguments of
+// a function call, such as "a", 1, [2]
+func traceArguments(args []object.Object) string {
+	formatted := []string{}
+	for _, arg := range args {
+		formatted = append(formatted, traceValue(arg))
+	}
+
+	return strings.Join(formatted, ", ")
+}
+
+// traceValue formats a value the way it
+// would be written in code, such as "a"
+// for strings
+func traceValue(o object.Object) string {
+	switch o := o.(type) {
+	case nil:
+		return "null"
+	case *object.Error:
+		return "ERROR: " + o.Message
+	case *object.String:
+		return o.Json()
+	}
+
+	return o.Inspect()
+}
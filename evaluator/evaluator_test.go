@@ -1,9 +1,11 @@
 package evaluator
 
 import (
+	"bytes"
 	"flag"
 	"fmt"
 	"io/ioutil"
+	"os"
 	"runtime"
 	"strconv"
 	"strings"
@@ -136,6 +138,59 @@ func TestEvalNumberExpression(t *testing.T) {
 	}
 }
 
+func TestEvalBigNumberExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"9007199254740993", "9007199254740993"},
+		{"-9007199254740993", "-9007199254740993"},
+		{"9007199254740992 + 1", "9007199254740993"},
+		{"9007199254740993 - 1", "9007199254740992"},
+		{"9007199254740993 - 9007199254740992", "1"},
+		{"4294967296 * 4294967296", "18446744073709551616"},
+		{"2 ** 64", "18446744073709551616"},
+		{"2 ** 64 - 1", "18446744073709551615"},
+		{"2 ** -1", "0.5"},
+		{"(2 ** 64) / 2", "9223372036854775808"},
+		{"(2 ** 64 + 5) % 10", "1"},
+		{"(2 ** 64) * 1.5", "27670116110564327000"},
+		{"9007199254740993 > 9007199254740992", "true"},
+		{"9007199254740993 == 9007199254740992", "false"},
+		{"9007199254740993 != 9007199254740992", "true"},
+		{"9007199254740993 <=> 9007199254740992", "1"},
+		{"9007199254740993 < 1.5", "false"},
+		{"1 << 64", "18446744073709551616"},
+		{"(1 << 64) >> 63", "2"},
+		{"1 << 1.1", "2"},
+		{"-8 >> 1", "-4"},
+		{"(2 ** 64) | 1", "18446744073709551617"},
+		{"(2 ** 64 + 1) & 1", "1"},
+		{"(2 ** 64) ^ (2 ** 64)", "0"},
+		{"~(2 ** 64)", "-18446744073709551617"},
+		{"(2 ** 64) ~ (2 ** 64)", "true"},
+		{"(9007199254740993..9007199254740995).str()", "[9007199254740993, 9007199254740994, 9007199254740995]"},
+		{"(9007199254740995..9007199254740993).str()", "[9007199254740995, 9007199254740994, 9007199254740993]"},
+		{"[2 ** 70].str()", "[1180591620717411303424]"},
+		{`{"a": 2 ** 70}.str()`, `{"a": 1180591620717411303424}`},
+		{`"[1180591620717411303424]".json()[0] + 1`, "1180591620717411303425"},
+		{"1 << -1", "invalid shift amount: -1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		if errObj, ok := evaluated.(*object.Error); ok {
+			logErrorWithPosition(t, errObj.Message, tt.expected)
+			continue
+		}
+
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. want=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
 func TestCompoundExpression(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -468,6 +523,9 @@ func TestForInExpressions(t *testing.T) {
 		{"a = 0; for x in 1..10 { a = a + 1}; a", 10},
 		{`a = 0; for k, v in {"a": 10} { a = v}; a`, 10},
 		{`a = ""; b = "abc"; for k, v in {"a": 1, "b": 2, "c": 3} { a += k}; a == b`, true},
+		{`a = ""; b = "cab"; for k, v in {"c": 1, "a": 2, "b": 3} { a += k}; a == b`, true},
+		{`a = ""; h = {"c": 1, "a": 2}; h.b = 3; for k, v in h { a += k}; a == "cab"`, true},
+		{`a = ""; h = {"c": 1, "a": 2}; for k, v in h { a += k}; for k, v in h { a += k}; a == "caca"`, true},
 		{`a = 0; for k, v in ["x", "y", "z"] { a = a + k}; a`, 3},
 		{`for k, v in ["x", "y", "z"] {}; k`, "identifier not found: k"},
 		{`for k, v in ["x", "y", "z"] {}; v`, "identifier not found: v"},
@@ -721,6 +779,444 @@ if (10 > 1) {
 	}
 }
 
+func TestMatchExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`match 1 { 1 => "one", 2 => "two" }`, "one"},
+		{`match 2 { 1 => "one", 2 => "two" }`, "two"},
+		{`match 3 { 1 => "one", 2 => "two" }`, nil},
+		{`match 3 { 1 => "one", _ => "other" }`, "other"},
+		{`match "a" { "a" => 1, "b" => 2 }`, 1},
+		{`match "1" { 1 => "number", "1" => "string" }`, "string"},
+		{`match null { null => 1, _ => 2 }`, 1},
+		{`match true { false => 1, true => 2 }`, 2},
+		{`match 5 { 1..4 => "low", 5..9 => "mid", _ => "high" }`, "mid"},
+		{`match 4.5 { 1..4 => "low", 5..9 => "mid", _ => "high" }`, "high"},
+		{`match "a" { 1..4 => "low", _ => "other" }`, "other"},
+		{`match 5 { 1.."a" => "low", _ => "other" }`, "range patterns can only be numerical"},
+		{`match [1, 2] { [a] => a, [a, b] => a + b }`, 3},
+		{`match [1, 2] { [a, b, c] => 1, [_, _, _] => 2 }`, nil},
+		{`match [1, [2, 3]] { [1, [x, 3]] => x }`, 2},
+		{`match [1, 2] { [2, x] => x, [1, x] => x * 10 }`, 20},
+		{`match {"name": "abs", "age": 5} { {"name": n, "age": 5} => n }`, "abs"},
+		{`match {"name": "abs"} { {"name": n, "age": a} => 1, {"name": n} => n }`, "abs"},
+		{`match {"a": [1, 2]} { {"a": [_, x]} => x }`, 2},
+		{`match [1, 2] { {"a": x} => 1, _ => 2 }`, 2},
+		{`match 10 { x if x > 5 => "big", x => "small" }`, "big"},
+		{`match 1 { x if x > 5 => "big", x => "small" }`, "small"},
+		{`match [2, 1] { [a, b] if a > b => a, [a, b] => b }`, 2},
+		{`match 1 { x => x }; x`, "identifier not found: x"},
+		{`match 1 { x if x > 5 => 1, _ => 2 }; x`, "identifier not found: x"},
+		{`a = 1; match 2 { a if false => a, _ => 3 }; a`, 1},
+		{`a = 1; match 2 { a => a * 10 }`, 20},
+		{`a = 1; match 2 { a => a * 10 }; a`, 1},
+		{`match [1, 2] { [a, b] => { c = a + b } }; c`, 3},
+		{`match 1 { _ => 2 }; _`, "identifier not found: _"},
+		{`match 1 { 1 => { a = 10; a * 2 } }`, 20},
+		{`f test(x) { match x { 1 => { return "one" } }; return "other" }; test(1)`, "one"},
+		{`f test(x) { match x { 1 => { return "one" } }; return "other" }; test(2)`, "other"},
+		{`match y { _ => 1 }`, "identifier not found: y"},
+		{`match 1 { 1 => y }`, "identifier not found: y"},
+		{`match 1 { x if y => 1 }`, "identifier not found: y"},
+		{"match `echo hello` { \"hello\" => 1, _ => 2 }", 1},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch ev := tt.expected.(type) {
+		case int:
+			testNumberObject(t, evaluated, float64(ev))
+		case nil:
+			testNullObject(t, evaluated)
+		case string:
+			if errObj, ok := evaluated.(*object.Error); ok {
+				logErrorWithPosition(t, errObj.Message, ev)
+				continue
+			}
+			testStringObject(t, evaluated, ev)
+		}
+	}
+}
+
+func TestTryExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`try { 1 + "a" } catch e { 5 }`, 5},
+		{`try { 1 } catch e { 5 }`, 1},
+		{`try { 1 + "a" } catch { 5 }`, 5},
+		{`try { 1 + "a" } catch e { type(e) }`, "ERROR"},
+		{`try { 1 + "a" } catch e { "type mismatch: NUMBER + STRING" in e.str() }`, true},
+		{`try { throw "boom" } catch e { "boom" in e.str() }`, true},
+		{`try { throw 42 } catch e { "42" in e.str() }`, true},
+		{`x = ""; try { x += "a"; throw "boom"; x += "b" } catch { x += "c" } finally { x += "d" }; x`, "acd"},
+		{`x = ""; try { x += "a" } finally { x += "b" }; x`, "ab"},
+		{`f test() { try { return 1 } finally { 2 } }; test()`, 1},
+		{`f test() { try { return 1 } finally { return 2 } }; test()`, 2},
+		{`f test() { try { throw "a" } catch e { return e } }; type(test())`, "ERROR"},
+		{`x = 0; for i in 1..10 { try { if i > 2 { break } } catch { x = 100 }; x += 1 }; x`, 2},
+		{`x = 0; for i in 1..3 { try { continue } catch { x = 100 }; x += 1 }; x`, 0},
+		{`x = ""; try { try { throw "inner" } catch e { x += "a"; throw e } } catch e { if "inner" in e.str() { x += "b" } }; x`, "ab"},
+		{`x = {"test": ""}; f deferred() { x.test += "b" }; f fn() { defer deferred(); x.test += "a"; throw "boom" }; try { fn() } catch { x.test += "c" }; x.test`, "abc"},
+		{`e = 1; try { throw "boom" } catch e { 2 }; e`, 1},
+		{`try { throw "boom" } catch err { 2 }; type(err)`, "identifier not found: err"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch ev := tt.expected.(type) {
+		case int:
+			testNumberObject(t, evaluated, float64(ev))
+		case bool:
+			testBooleanObject(t, evaluated, ev)
+		case string:
+			if errObj, ok := evaluated.(*object.Error); ok && !errObj.Caught {
+				logErrorWithPosition(t, errObj.Message, ev)
+				continue
+			}
+			testStringObject(t, evaluated, ev)
+		}
+	}
+}
+
+func TestThrowStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`throw "boom"`, "boom"},
+		{`throw "boom"; 1`, "boom"},
+		{`f test() { throw "inner" }; test(); 1`, "inner"},
+		{`try { throw "a" } catch e { throw e }`, "a"},
+		{`try { throw "a" } finally { 1 }`, "a"},
+		{`try { 1 } finally { throw "b" }`, "b"},
+		{`try { throw "a" } catch { throw "b" }`, "b"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok || errObj.Caught {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+		logErrorWithPosition(t, errObj.Message, tt.expected)
+	}
+}
+
+func TestErrorProperties(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`try { 1 + "a" } catch e { e.message }`, "type mismatch: NUMBER + STRING"},
+		{`try { 1 + "a" } catch e { e.kind }`, "TypeError"},
+		{`try { 1 + "a" } catch e { e.line }`, 1},
+		{`try { 1 + "a" } catch e { e.column }`, 9},
+		{`try { 1 + "a" } catch e { e.file }`, ""},
+		{`try {
+  x = 1
+  y = x + z
+} catch e { [e.kind, e.line, e.column].str() }`, `["NameError", 3, 11]`},
+		{`try { a = [1]; a[-1] = 2 } catch e { e.kind }`, "IndexError"},
+		{`try { len() } catch e { e.kind }`, "ArgumentError"},
+		{`try { throw "boom" } catch e { e.kind }`, "Error"},
+		{`try { throw "boom" } catch e { e.message }`, "boom"},
+		{`try { throw "boom" } catch e { e.stack.len() }`, 1},
+		{`try { throw "boom" } catch e { e.stack[0].line }`, 1},
+		{`try { throw "boom" } catch e { e.stack[0].code }`, `try { throw "boom" } catch e { e.stack[0].code }`},
+		{`try { throw "boom" } catch e { e.nope }`, "invalid property 'nope' on type ERROR"},
+		{`try { throw "boom" } catch e { e?.nope }`, nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch ev := tt.expected.(type) {
+		case int:
+			testNumberObject(t, evaluated, float64(ev))
+		case nil:
+			testNullObject(t, evaluated)
+		case string:
+			if errObj, ok := evaluated.(*object.Error); ok && !errObj.Caught {
+				logErrorWithPosition(t, errObj.Message, ev)
+				continue
+			}
+			testStringObject(t, evaluated, ev)
+		}
+	}
+}
+
+func TestTrace(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("trace tests rely on unix utilities")
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"a = 1\na + 1", "+ 1: a = 1\n+ 2: a + 1\n"},
+		{"a = 1; b = 2", "+ 1: a = 1\n+ 1: b = 2\n"},
+		{"x = 'ünï'; y = 1", "+ 1: x = 'ünï'\n+ 1: y = 1\n"},
+		{"if true {\n  1\n}", "+ 1: if true {\n+ 2: 1\n"},
+		{"dir = 'a b'\n`echo $dir`", "+ 1: dir = 'a b'\n+ 2: `echo $dir`\n+ 2: $ echo 'a b'\n"},
+		{"run(['echo', 'a b'])", "+ 1: run(['echo', 'a b'])\n+ 1: $ echo 'a b'\n"},
+		{"exec('true')", "+ 1: exec('true')\n+ 1: $ true\n"},
+		{"f double(x) {\n  return x + x\n}\ndouble('a')", "+ 1: f double(x) {\n+ 4: double('a')\n+ 4: -> double(\"a\")\n++ 2: return x + x\n+ 4: <- double: \"aa\"\n"},
+		{"f boom() {\n  throw 'boom'\n}\ntry { boom() } catch e {}", "+ 1: f boom() {\n+ 4: try { boom() } catch e {}\n+ 4: boom()\n+ 4: -> boom()\n++ 2: throw 'boom'\n+ 4: <- boom: ERROR: boom\n"},
+	}
+
+	for _, tt := range tests {
+		trace := &bytes.Buffer{}
+		env := object.NewEnvironment(object.SystemStdio, "", "test_version", false)
+		env.Settings.Trace = trace
+		lex := lexer.New(tt.input)
+		BeginEval(parser.New(lex).ParseProgram(), env, lex)
+
+		if trace.String() != tt.expected {
+			t.Errorf("wrong trace for %q. expected=%q, got=%q", tt.input, tt.expected, trace.String())
+		}
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("dry-run tests rely on unix utilities")
+	}
+
+	file := "test-ignore-dry-run.txt"
+	tests := []struct {
+		input    string
+		expected string
+		output   string
+	}{
+		{"ABS_DRY_RUN", "true", ""},
+		{"dir = 'a b'; `touch $dir`", "", "[dry-run] $ touch 'a b'\n"},
+		{"`touch a`.ok", "true", "[dry-run] $ touch a\n"},
+		{"`touch a`.exit_code", "0", "[dry-run] $ touch a\n"},
+		{"`touch a &`.wait().done", "true", "[dry-run] $ touch a\n"},
+		{"$(touch a)", "", "[dry-run] $ touch a\n"},
+		{"exec('touch a')", "null", "[dry-run] $ touch a\n"},
+		{"run(['touch', 'a b'])", "", "[dry-run] $ touch 'a b'\n"},
+		{"run(`echo a`, {'safe': true})", "a", ""},
+		{"run_all([`echo a`, ['echo', 'b']])", `["", ""]`, "[dry-run] $ echo a\n[dry-run] $ echo b\n"},
+		{"lines = []; for l in stream(`echo a`) { lines.push(l) }; lines", "[]", "[dry-run] $ echo a\n"},
+		{"'abc' > '" + file + "'", "true", "[dry-run] write 3 bytes to " + file + "\n"},
+		{"'abc' >> '" + file + "'", "true", "[dry-run] append 3 bytes to " + file + "\n"},
+		{"strict(); `exit 1`.ok", "true", "[dry-run] $ exit 1\n"},
+		{"mkdir('" + file + "')", "null", "[dry-run] create directory " + file + "\n"},
+		{"write_file('" + file + "', 'abc')", "null", "[dry-run] write 3 bytes to " + file + "\n"},
+		{"http.post('http://127.0.0.1:1/users', {'json': {}}).status", "200", "[dry-run] POST http://127.0.0.1:1/users\n"},
+		{"try { http.post('http://127.0.0.1:1/users', {'safe': true}) } catch e { e.kind }", "HTTPError", ""},
+		{"try { http.get('http://127.0.0.1:1/users') } catch e { e.kind }", "HTTPError", ""},
+	}
+
+	for _, tt := range tests {
+		stderr := &bytes.Buffer{}
+		env := object.NewEnvironment(&object.Stdio{Stdin: os.Stdin, Stdout: os.Stdout, Stderr: stderr}, "", "test_version", false)
+		env.SetSettings(&object.Settings{DryRun: true})
+		lex := lexer.New(tt.input)
+		evaluated := BeginEval(parser.New(lex).ParseProgram(), env, lex)
+
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+
+		if stderr.String() != tt.output {
+			t.Errorf("wrong output for %q. expected=%q, got=%q", tt.input, tt.output, stderr.String())
+		}
+	}
+
+	if _, err := os.Stat(file); err == nil {
+		t.Errorf("file %s should not have been written in dry-run mode", file)
+	}
+}
+
+func TestExit(t *testing.T) {
+	tests := []struct {
+		input    string
+		code     int
+		expected string
+	}{
+		{"exit(2)", 2, ""},
+		{"try { exit(3) } catch e { echo('caught') }", 3, ""},
+		{"for x in 1..3 { exit(x) }", 1, ""},
+		{"for x = 0; x < 3; x = x + 1 { exit(4) }", 4, ""},
+		{"f x() { defer echo('deferred'); exit(5) }; x()", 5, "deferred\n"},
+		{"try { exit(6) } finally { echo('finally') }", 6, "finally\n"},
+		{"exit(7); echo('unreachable')", 7, ""},
+		{"eval('exit(8)')", 8, ""},
+		{"'exit(9)' > 'test-ignore-require-exit.abs'; require('test-ignore-require-exit.abs')", 9, ""},
+	}
+
+	for _, tt := range tests {
+		stdout := &bytes.Buffer{}
+		env := object.NewEnvironment(&object.Stdio{Stdin: os.Stdin, Stdout: stdout, Stderr: os.Stderr}, "", "test_version", false)
+		lex := lexer.New(tt.input)
+		evaluated := BeginEval(parser.New(lex).ParseProgram(), env, lex)
+
+		exit, ok := evaluated.(*object.ExitError)
+		if !ok {
+			t.Errorf("expected %q to exit. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+
+		if exit.Code != tt.code {
+			t.Errorf("wrong exit code for %q. expected=%d, got=%d", tt.input, tt.code, exit.Code)
+		}
+
+		if stdout.String() != tt.expected {
+			t.Errorf("wrong output for %q. expected=%q, got=%q", tt.input, tt.expected, stdout.String())
+		}
+	}
+
+	// A module that exited isn't cached,
+	// so it's run again when required
+	evaluated := testEval("'return 10' > 'test-ignore-require-exit.abs'; require('test-ignore-require-exit.abs')")
+	testNumberObject(t, evaluated, float64(10))
+}
+
+func TestTraps(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("trap tests rely on unix signals")
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"at_exit(f() { echo('a') }); at_exit(f() { echo('b') }); 1", "b\na\n"},
+		{"at_exit(f() { echo('a') }); at_exit(f() { x.y }); 1", "ERROR: identifier not found: x\n\t[1:43]\tat_exit(f() { echo('a') }); at_exit(f() { x.y }); 1\na\n"},
+		{"on_signal('USR1', f(sig) { echo(sig) }); `kill -USR1 \\$PPID`; sleep(50); echo('after')", "USR1\nafter\n"},
+		{"on_signal('SIGUSR2', f(sig) { exit(2) }); `kill -USR2 \\$PPID`; sleep(50); echo('after')", ""},
+		{"on_signal('USR1', f(sig) { throw 'boom' }); try { `kill -USR1 \\$PPID`; sleep(50); echo('after') } catch e { echo(e.message) }", "boom\n"},
+		{"on_signal('USR1', f(sig) { echo(sig) }); on_signal('USR1', null); on_signal('USR1', f(sig) { echo('again') }); `kill -USR1 \\$PPID`; sleep(50)", "again\n"},
+		{"try { on_signal('KILL', f() {}) } catch e { echo(e.message) }", "signal KILL cannot be handled\n"},
+		{"try { on_signal('NOPE', f() {}) } catch e { echo(e.kind) }", "ArgumentError\n"},
+	}
+
+	for _, tt := range tests {
+		stdout := &bytes.Buffer{}
+		env := object.NewEnvironment(&object.Stdio{Stdin: os.Stdin, Stdout: stdout, Stderr: os.Stderr}, "", "test_version", false)
+		lex := lexer.New(tt.input)
+		BeginEval(parser.New(lex).ParseProgram(), env, lex)
+		AtExit(env)
+
+		if stdout.String() != tt.expected {
+			t.Errorf("wrong output for %q. expected=%q, got=%q", tt.input, tt.expected, stdout.String())
+		}
+	}
+}
+
+func TestStrictMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("strict mode tests rely on unix utilities")
+	}
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"strict(); h = {}; h.a", `key "a" not found in hash`},
+		{"strict(); h = {}; h['a']", `key "a" not found in hash`},
+		{"strict(); h = {}; h[1]", `key 1 not found in hash`},
+		{"strict(); try { {}.a } catch e { e.kind }", "KeyError"},
+		{"strict(); h = {}; h?.a", nil},
+		{"strict(); h = {'a': null}; h.a", nil},
+		{"strict(); h = {'a': 1}; h.a", 1},
+		{"h = {}; h.a", nil},
+		{"strict(); strict(false); h = {}; h.a", nil},
+		{"strict(); f x() { return {}.a }; try { x() } catch e { e.kind }", "KeyError"},
+		{"strict(); `exit 2`", "command `exit 2` failed with exit code 2"},
+		{"strict(); `echo oops >&2; exit 2`", "command `echo oops >&2; exit 2` failed with exit code 2: oops"},
+		{"strict(); $(exit 2)", "command `exit 2` failed with exit code 2"},
+		{"strict(); try { `exit 2` } catch e { e.kind }", "CommandError"},
+		{"strict(); try { `exit 2` } catch e { e.exit_code }", 2},
+		{"strict(); try { `exit 2` } catch e { e.command }", "exit 2"},
+		{"strict(); try { `echo oops >&2; exit 2` } catch e { e.stderr }", "oops\n"},
+		{"strict(); try { `exit 2` } catch e { json_encode(e) }", `{"message": "command ` + "`exit 2`" + ` failed with exit code 2", "kind": "CommandError", "file": "", "line": 1, "column": 17, "command": "exit 2", "stderr": "", "exit_code": 2}`},
+		{"strict(); `echo a`", "a"},
+		{"strict(); `exit 2 &`.wait().exit_code", 2},
+		{"strict(); run(['false'])", "command `false` failed with exit code 1"},
+		{"strict(); try { run(`exit 3`) } catch e { e.exit_code }", 3},
+		{"strict(); run(['true']).ok", true},
+		{"strict(); exec('exit 3')", "command `exit 3` failed with exit code 3"},
+		{"strict(); exec('true')", nil},
+		{"strict(); run_all([`true`, `exit 3`, `exit 4`]).map(f(c) { return c.ok }).str()", "[true, false, false]"},
+		{"strict(); run_all([`true`, `echo a`]).len()", 2},
+		{"strict(); for l in stream(`echo a; exit 3`) {}", "command `echo a; exit 3` failed with exit code 3"},
+		{"strict(); n = 0; for l in stream(`echo a; echo b; exit 3`) { n += 1; break }; n", 1},
+		{"strict(); strict(false); `exit 2`.exit_code", 2},
+		{"try { throw 'boom' } catch e { e.command }", nil},
+		{"strict(1)", "Wrong arguments passed to 'strict'. Usage:\nstrict()\nstrict(BOOLEAN)"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch ev := tt.expected.(type) {
+		case int:
+			testNumberObject(t, evaluated, float64(ev))
+		case nil:
+			testNullObject(t, evaluated)
+		case string:
+			if errObj, ok := evaluated.(*object.Error); ok && !errObj.Caught {
+				logErrorWithPosition(t, errObj.Message, ev)
+				continue
+			}
+			testStringObject(t, evaluated, ev)
+		}
+	}
+}
+
+func TestStackTraces(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`1 + "a"`, "<main>:1"},
+		{`f a() { 1 + "a" }; a()`, "a:1,<main>:1"},
+		{`f a() {
+  1 + "a"
+}
+f b() {
+  a()
+}
+b()`, "a:2,b:5,<main>:7"},
+		{`f a() { throw "boom" }; f b() { a() }; [1].map(f(x) { b() })`, "a:1,b:1,<anonymous>:1,<main>:1"},
+		{`f a(x) { x }; a()`, "a:1,<main>:1"},
+		{`f a() { throw "boom" }; try { a() } catch e { throw e }`, "a:1,<main>:1"},
+		{`"f a() {\n  throw \"boom\"\n}; return {\"a\": a}" > "test-ignore-stack-traces.abs"; m = require("test-ignore-stack-traces.abs"); m.a()`, "a:2,<main>:1"},
+		{`"\n\n1 + \"a\"" > "test-ignore-stack-traces.1.abs"; f a() { source("test-ignore-stack-traces.1.abs") }; a()`, "<main>:3,a:1,<main>:1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+
+		frames := []string{}
+		for _, frame := range errObj.Stack {
+			frames = append(frames, fmt.Sprintf("%s:%d", frame.Function, frame.Line))
+		}
+
+		if strings.Join(frames, ",") != tt.expected {
+			t.Errorf("wrong stack trace for %s. want=%s, got=%s", tt.input, tt.expected, strings.Join(frames, ","))
+		}
+	}
+}
+
 func TestAssignStatements(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -1098,6 +1594,14 @@ func TestInExpressions(t *testing.T) {
 		{`"xyz" in ["abc", "def"]`, false},
 		{`"x" in {"x": 0}`, true},
 		{`"y" in {"x": 0}`, false},
+		{`1 in {1: 0}`, true},
+		{`1.0 in {1: 0}`, true},
+		{`"1" in {1: 0}`, false},
+		{`1 in {"1": 0}`, false},
+		{`true in {true: 0}`, true},
+		{`false in {true: 0}`, false},
+		{`null in {null: 0}`, true},
+		{`[1] in {1: 0}`, false},
 		{`"y" in 12`, "'in' operator not supported on NUMBER"},
 		{`1 !in [1]`, false},
 		{`1 !in []`, true},
@@ -1134,7 +1638,8 @@ func TestBuiltinProperties(t *testing.T) {
 		{"a = $(echo hello);\na.ok", true},
 		{`{}.a`, nil},
 		{`{"a": 1}.a`, 1},
-		{`{1: 1}.1`, "unusable as hash key: NUMBER"},
+		{`{[1]: 1}.a`, "unusable as hash key: ARRAY"},
+		{`{1: 1}.1`, nil},
 		{`[].a`, "invalid property 'a' on type ARRAY"},
 	}
 	for _, tt := range tests {
@@ -1237,9 +1742,22 @@ func TestCommand(t *testing.T) {
 			{"`sleep 0.01`", ""},
 			{"`sleep 0.01`.done", true},
 			{"`sleep 0.01`.ok", true},
+			{"`sleep 0.01`.timed_out", false},
 			{"`sleep 0.01 &`", ""},
 			{"`sleep 0.01 &`.done", false},
 			{"`sleep 0.01 &`.ok", false},
+			{"x = 'a  b; echo injected'; `echo -n $x`", "a  b; echo injected"},
+			{"x = 'a  b; echo injected'; exec(\"echo $x > test-ignore-exec.txt\"); `cat test-ignore-exec.txt; rm test-ignore-exec.txt`", "a  b; echo injected"},
+			{"x = 'a  b; echo injected'; \"echo $x > test-ignore-exec.txt\".exec(); `cat test-ignore-exec.txt; rm test-ignore-exec.txt`", "a  b; echo injected"},
+			{"x = 'a  b; echo injected'; `echo $x > test-ignore-exec.txt`.exec(); `cat test-ignore-exec.txt; rm test-ignore-exec.txt`", "a  b; echo injected"},
+			{"exec(`echo -n a > test-ignore-exec.txt`); `cat test-ignore-exec.txt; rm test-ignore-exec.txt`", "a"},
+			{"x = `echo -n echo b`; exec(\"$!{x} > test-ignore-exec.txt\"); `cat test-ignore-exec.txt; rm test-ignore-exec.txt`", "b"},
+			{"x = \"it's\"; `echo -n \"$x here\"`", "it's here"},
+			{"x = \"it's\"; `echo -n '$x here'`", "it's here"},
+			{"x = ['a b', 'c']; `printf '%s|' $x`", "a b|c|"},
+			{"x = ['a b', 'c']; `printf '%s|' ${x}`", "a b|c|"},
+			{"x = 'a b'; `printf '%s|' $!{x}`", "a|b|"},
+			{"x = '-n'; `echo $!{x} hello`", "hello"},
 			{"`sleep 0.01 &`.wait().ok", true},
 			{"`sleep 0.01 && echo 123 &`.wait()", "123"},
 			{"`sleep 0.01 && echo 123 &`.kill()", ""},
@@ -1248,6 +1766,22 @@ func TestCommand(t *testing.T) {
 			{"`echo 123; sleep 10 &`.ok", false},
 			{"`echo 123; sleep 10 &`.kill().done", true},
 			{"`echo 123; sleep 10 &`.kill().ok", false},
+			{"`echo 123`.exit_code", 0},
+			{"`exit 3`.exit_code", 3},
+			{"`echo out; echo err >&2; exit 2`.stdout", "out\n"},
+			{"`echo out; echo err >&2; exit 2`.stderr", "err\n"},
+			{"`echo out; echo err >&2; exit 2`", "err"},
+			{"`echo out; echo err >&2`.stderr", "err\n"},
+			{"`echo 123`.pid > 0", true},
+			{"`sleep 0.01`.duration >= 10", true},
+			{"`sleep 0.01 &`.exit_code", nil},
+			{"`sleep 0.01 &`.stdout", nil},
+			{"`sleep 0.01 &`.pid > 0", true},
+			{"`echo 1 && exit 4 &`.wait().exit_code", 4},
+			{"`echo 1 && exit 4 &`.wait().stdout", "1\n"},
+			{"`sleep 10 &`.kill().exit_code", -1},
+			{"'abc'.exit_code", nil},
+			{"'abc'.pid", nil},
 			{"`echo \\$0`", "bash"},
 			{"env('ABS_COMMAND_EXECUTOR', 'sh -c'); `echo \\$0`", "sh"},
 			{"env('ABS_COMMAND_EXECUTOR', 'bash -c'); `echo \\$0`", "bash"},
@@ -1259,6 +1793,8 @@ func TestCommand(t *testing.T) {
 		switch expected := tt.expected.(type) {
 		case nil:
 			testNullObject(t, evaluated)
+		case int:
+			testNumberObject(t, evaluated, float64(expected))
 		case string:
 			stringObj, ok := evaluated.(*object.String)
 			if !ok {
@@ -1444,6 +1980,52 @@ func TestHashLiterals(t *testing.T) {
 	}
 }
 
+func TestHashLiteralsWithNonStringKeys(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`{1: "a"}[1]`, "a"},
+		{`{1: "a"}[1.0]`, "a"},
+		{`{1: "a"}["1"]`, nil},
+		{`{"1": "a"}[1]`, nil},
+		{`{1: "a", "1": "b"}[1]`, "a"},
+		{`{1: "a", "1": "b"}["1"]`, "b"},
+		{`{1.5: "a"}[3 / 2]`, "a"},
+		{`{true: "a", false: "b"}[1 == 1]`, "a"},
+		{`{true: "a", false: "b"}[false]`, "b"},
+		{`{null: "a"}[null]`, "a"},
+		{`{9007199254740993: "a"}[9007199254740993]`, "a"},
+		{`{9007199254740993: "a"}[9007199254740992]`, nil},
+		{`h = {}; h[1] = "a"; h[true] = "b"; h[1] + h[true]`, "ab"},
+		{`h = {1: "a", "1": "b"}; h.pop(1); h["1"]`, "b"},
+		{`h = {1: "a", "1": "b"}; h.pop(1); h[1]`, nil},
+		{`{1: "a", "1": "b", true: "c", null: "d"}.str()`, `{1: "a", "1": "b", true: "c", null: "d"}`},
+		{`[{1: [{true: null}]}].str()`, `[{1: [{true: null}]}]`},
+		{`s = ""; for k, v in {1: "a", "1": "b"} { s += type(k) + "," }; s`, "NUMBER,STRING,"},
+		{`{[1]: "a"}`, "unusable as hash key: ARRAY"},
+		{`{{}: "a"}`, "unusable as hash key: HASH"},
+		{`{"a": 1}.pop([1])`, "unusable as hash key: ARRAY"},
+		{`{"a": 1}[[1]]`, "index operator not supported: [1] on HASH"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case nil:
+			testNullObject(t, evaluated)
+		case string:
+			if errObj, ok := evaluated.(*object.Error); ok {
+				logErrorWithPosition(t, errObj.Message, expected)
+				continue
+			}
+
+			testStringObject(t, evaluated, expected)
+		}
+	}
+}
+
 func TestOptionalChaining(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -1770,7 +2352,7 @@ func TestEvalAssignIndex(t *testing.T) {
 		h.z.x = 66
 		h.f = 1.23
 		str(h)
-		`, `{"1.23": "string", "a": 100, "b": 2, "c": 33, "d": 100, "e": 55, "f": 1.23, "z": {"x": 66, "y": 20}}`,
+		`, `{"a": 100, "b": 2, "c": 33, "d": 100, "e": 55, "z": {"x": 66, "y": 20}, "1.23": "string", "f": 1.23}`,
 		},
 	}
 
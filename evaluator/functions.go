@@ -2,24 +2,37 @@ package evaluator
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"math"
 	"math/big"
 	mrand "math/rand"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
+	"os/signal"
 	"os/user"
 	"path/filepath"
+	"reflect"
+	"runtime"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 	"unicode"
 
-	"github.com/abs-lang/abs/ast"
 	"github.com/abs-lang/abs/lexer"
 	"github.com/abs-lang/abs/object"
 	"github.com/abs-lang/abs/parser"
@@ -66,6 +79,27 @@ func GetFns() map[string]*object.Builtin {
 			Standalone: true,
 			Doc:        "exists the current process",
 		},
+		// strict() or strict(false)
+		"strict": &object.Builtin{
+			Types:      []string{},
+			Fn:         strictFn,
+			Standalone: true,
+			Doc:        "turns strict mode on or off: failing commands and missing hash keys raise errors",
+		},
+		// on_signal("INT", f(sig) { ... })
+		"on_signal": &object.Builtin{
+			Types:      []string{},
+			Fn:         onSignalFn,
+			Standalone: true,
+			Doc:        "runs a function when the script receives a signal, such as INT or TERM",
+		},
+		// at_exit(f() { ... })
+		"at_exit": &object.Builtin{
+			Types:      []string{},
+			Fn:         atExitFn,
+			Standalone: true,
+			Doc:        "runs a function when the script exits",
+		},
 		// flag("my-flag")
 		"flag": &object.Builtin{
 			Types:      []string{object.STRING_OBJ},
@@ -193,6 +227,13 @@ func GetFns() map[string]*object.Builtin {
 			Fn:    typeFn,
 			Doc:   "returns the type of a variable",
 		},
+		// error("something went wrong") or error("file not found", "IOError")
+		"error": &object.Builtin{
+			Types:      []string{object.STRING_OBJ},
+			Fn:         errorFn,
+			Standalone: true,
+			Doc:        "creates an error with the given message and, optionally, kind",
+		},
 		// fn.call(args_array)
 		"call": &object.Builtin{
 			Types: []string{object.FUNCTION_OBJ, object.BUILTIN_OBJ},
@@ -224,6 +265,12 @@ func GetFns() map[string]*object.Builtin {
 			Fn:    jsonFn,
 			Doc:   "converts a valid json document to a hash",
 		},
+		// json_encode({"a": 1}, {"indent": 2, "sort_keys": true})
+		"json_encode": &object.Builtin{
+			Types: []string{},
+			Fn:    jsonEncodeFn,
+			Doc:   "converts a value to a json document",
+		},
 		// "a %s".fmt(b)
 		"fmt": &object.Builtin{
 			Types: []string{object.STRING_OBJ},
@@ -255,10 +302,11 @@ func GetFns() map[string]*object.Builtin {
 			Doc:   "iterate through the array and reduce it to a value",
 		},
 		// sort(array:[1, 2, 3])
+		// sort(hash:{"b": 1, "a": 2})
 		"sort": &object.Builtin{
-			Types: []string{object.ARRAY_OBJ},
+			Types: []string{object.ARRAY_OBJ, object.HASH_OBJ},
 			Fn:    sortFn,
-			Doc:   "sort an array",
+			Doc:   "sort an array, or the keys of an hash",
 		},
 		// intersect(array:[1, 2, 3], array:[1, 2, 3])
 		"intersect": &object.Builtin{
@@ -404,6 +452,33 @@ func GetFns() map[string]*object.Builtin {
 			Types: []string{object.STRING_OBJ},
 			Fn:    killFn,
 		},
+		// signal(`sleep 10 &`, "TERM")
+		"signal": &object.Builtin{
+			Types: []string{object.STRING_OBJ},
+			Fn:    signalFn,
+			Doc:   "sends a signal, such as TERM or HUP, to a command",
+		},
+		// jobs()
+		"jobs": &object.Builtin{
+			Types:      []string{},
+			Fn:         jobsFn,
+			Standalone: true,
+			Doc:        "lists the commands started in background",
+		},
+		// wait_all()
+		"wait_all": &object.Builtin{
+			Types:      []string{},
+			Fn:         waitAllFn,
+			Standalone: true,
+			Doc:        "waits for all the commands running in background to finish",
+		},
+		// wait_any([`sleep 1 &`, `sleep 2 &`])
+		"wait_any": &object.Builtin{
+			Types:      []string{object.ARRAY_OBJ},
+			Fn:         waitAnyFn,
+			Standalone: true,
+			Doc:        "waits for any of the given commands to finish, and returns it",
+		},
 		// trim("abc")
 		"trim": &object.Builtin{
 			Types: []string{object.STRING_OBJ},
@@ -493,11 +568,41 @@ func GetFns() map[string]*object.Builtin {
 			Standalone: true,
 			Doc:        "require a file without giving it access to the global environment",
 		},
-		// exec(command) -- execute command with interactive stdio
+		// exec(command) or exec(command, {"timeout": 1000}) -- execute command with interactive stdio
 		"exec": &object.Builtin{
-			Types: []string{object.STRING_OBJ},
-			Fn:    execFn,
-			Doc:   "execute command with interactive stdio",
+			Types:       []string{object.STRING_OBJ},
+			Fn:          execFn,
+			RawCommands: true,
+			Doc:         "execute command with interactive stdio",
+		},
+		// run(["git", "status"], {"cwd": "/tmp", "timeout": 1000}) -- execute a command without a shell
+		// run(`curl $url`, {"timeout": 1000}) -- execute a command with options
+		"run": &object.Builtin{
+			Types:       []string{object.ARRAY_OBJ, object.STRING_OBJ},
+			Fn:          runFn,
+			RawCommands: true,
+			Doc:         "execute a command with options such as a timeout, optionally passing its arguments directly rather than through a shell",
+		},
+		// for line in stream(`tail -f app.log`) -- iterate over the output of a command as it's written
+		"stream": &object.Builtin{
+			Types:       []string{object.STRING_OBJ},
+			Fn:          streamFn,
+			Standalone:  true,
+			RawCommands: true,
+			Doc:         "runs a command so that its output can be iterated over, line by line, as it's written",
+		},
+		// run_all([`curl a.example.com`, `curl b.example.com`], 10) -- run commands concurrently
+		"run_all": &object.Builtin{
+			Types:       []string{object.ARRAY_OBJ},
+			Fn:          runAllFn,
+			RawCommands: true,
+			Doc:         "runs commands concurrently, with a limit, returning their results in order",
+		},
+		// parallel(hosts, f(host) { `ssh $host uptime` }, {"concurrency": 10}) -- call a function on items concurrently
+		"parallel": &object.Builtin{
+			Types: []string{object.ARRAY_OBJ},
+			Fn:    parallelFn,
+			Doc:   "calls a function on each item concurrently, with a limit, returning what it returned in order",
 		},
 		// eval(code) -- evaluates code in the context of the current ABS environment
 		"eval": &object.Builtin{
@@ -518,7 +623,181 @@ func GetFns() map[string]*object.Builtin {
 			Standalone: true,
 			Doc:        "returns the current unix epoch, in milliseconds",
 		},
+		// read_file(path)
+		"read_file": &object.Builtin{
+			Types:      []string{object.STRING_OBJ},
+			Fn:         readFileFn,
+			Standalone: true,
+			Doc:        "reads the contents of a file",
+		},
+		// write_file(path, content) or write_file(path, content, {"atomic": true})
+		"write_file": &object.Builtin{
+			Types:      []string{object.STRING_OBJ},
+			Fn:         writeFileFn,
+			Standalone: true,
+			Doc:        "writes a string to a file, replacing its contents",
+		},
+		// append_file(path, content)
+		"append_file": &object.Builtin{
+			Types:      []string{object.STRING_OBJ},
+			Fn:         appendFileFn,
+			Standalone: true,
+			Doc:        "appends a string to a file",
+		},
+		// exists(path)
+		"exists": &object.Builtin{
+			Types:      []string{object.STRING_OBJ},
+			Fn:         existsFn,
+			Standalone: true,
+			Doc:        "checks whether a file or directory exists",
+		},
+		// stat(path)
+		"stat": &object.Builtin{
+			Types:      []string{object.STRING_OBJ},
+			Fn:         statFn,
+			Standalone: true,
+			Doc:        "returns information about a file, such as its size, mode and modification time",
+		},
+		// list_dir(path)
+		"list_dir": &object.Builtin{
+			Types:      []string{object.STRING_OBJ},
+			Fn:         listDirFn,
+			Standalone: true,
+			Doc:        "lists the names of the entries of a directory",
+		},
+		// walk(path)
+		"walk": &object.Builtin{
+			Types:      []string{object.STRING_OBJ},
+			Fn:         walkFn,
+			Standalone: true,
+			Doc:        "lists the paths of all files and directories within a directory, recursively",
+		},
+		// mkdir(path)
+		"mkdir": &object.Builtin{
+			Types:      []string{object.STRING_OBJ},
+			Fn:         mkdirFn,
+			Standalone: true,
+			Doc:        "creates a directory, along with its parents",
+		},
+		// remove(path)
+		"remove": &object.Builtin{
+			Types:      []string{object.STRING_OBJ},
+			Fn:         removeFn,
+			Standalone: true,
+			Doc:        "removes a file or a directory, along with its contents",
+		},
+		// copy(src, dst)
+		"copy": &object.Builtin{
+			Types:      []string{object.STRING_OBJ},
+			Fn:         copyFn,
+			Standalone: true,
+			Doc:        "copies a file or a directory, along with its contents",
+		},
+		// move(src, dst)
+		"move": &object.Builtin{
+			Types:      []string{object.STRING_OBJ},
+			Fn:         moveFn,
+			Standalone: true,
+			Doc:        "moves a file or a directory",
+		},
+		// chmod(path, "755")
+		"chmod": &object.Builtin{
+			Types:      []string{object.STRING_OBJ},
+			Fn:         chmodFn,
+			Standalone: true,
+			Doc:        "changes the permissions of a file",
+		},
+		// watch(paths, f(event) {...}, {"recursive": true, "debounce": 100})
+		"watch": &object.Builtin{
+			Types:      []string{object.STRING_OBJ, object.ARRAY_OBJ},
+			Fn:         watchFn,
+			Standalone: true,
+			Doc:        "runs a function whenever the given files or directories change",
+		},
+		// glob("src/**/*.go")
+		"glob": &object.Builtin{
+			Types:      []string{object.STRING_OBJ},
+			Fn:         globFn,
+			Standalone: true,
+			Doc:        "returns the paths matching a pattern, such as src/**/*.go",
+		},
+		// tmp_file() or tmp_file({"keep": true, "pattern": "build-*.log"})
+		"tmp_file": &object.Builtin{
+			Types:      []string{},
+			Fn:         tmpFileFn,
+			Standalone: true,
+			Doc:        "creates a temporary file, removed when the function returns or the script exits",
+		},
+		// tmp_dir() or tmp_dir({"keep": true, "pattern": "build-*"})
+		"tmp_dir": &object.Builtin{
+			Types:      []string{},
+			Fn:         tmpDirFn,
+			Standalone: true,
+			Doc:        "creates a temporary directory, removed when the function returns or the script exits",
+		},
+		// symlink(target, link)
+		"symlink": &object.Builtin{
+			Types:      []string{object.STRING_OBJ},
+			Fn:         symlinkFn,
+			Standalone: true,
+			Doc:        "creates a symbolic link pointing to target",
+		},
+	}
+}
+
+// GetModules returns the builtin functions that are
+// grouped under a name, such as path.join(...), rather
+// than being available on their own.
+func GetModules() map[string]map[string]*object.Builtin {
+	return map[string]map[string]*object.Builtin{
+		"path": {
+			// path.join("a", "b", "c.txt")
+			"join": {Fn: pathJoinFn, Doc: "joins paths, such as a, b and c.txt into a/b/c.txt"},
+			// path.base("/a/b.txt")
+			"base": {Fn: pathBaseFn, Doc: "returns the last element of a path, such as b.txt"},
+			// path.dir("/a/b.txt")
+			"dir": {Fn: pathDirFn, Doc: "returns all but the last element of a path, such as /a"},
+			// path.ext("/a/b.txt")
+			"ext": {Fn: pathExtFn, Doc: "returns the extension of a path, such as .txt"},
+			// path.abs("b.txt")
+			"abs": {Fn: pathAbsFn, Doc: "returns the absolute version of a path"},
+			// path.rel("/a/b.txt") or path.rel("/a/b.txt", "/a")
+			"rel": {Fn: pathRelFn, Doc: "returns a path relative to the directory of the script, or to a base path"},
+			// path.clean("a/../b/./c.txt")
+			"clean": {Fn: pathCleanFn, Doc: "returns the shortest equivalent of a path, such as b/c.txt"},
+		},
+		"http": {
+			// http.get("https://api.example.com/users", {"query": {"page": 2}})
+			"get": {Fn: httpMethodFn(http.MethodGet), Doc: "sends a GET request"},
+			// http.post("https://api.example.com/users", {"json": {"name": "Jane"}})
+			"post": {Fn: httpMethodFn(http.MethodPost), Doc: "sends a POST request"},
+			// http.put("https://api.example.com/users/1", {"json": {"name": "Jane"}})
+			"put": {Fn: httpMethodFn(http.MethodPut), Doc: "sends a PUT request"},
+			// http.delete("https://api.example.com/users/1")
+			"delete": {Fn: httpMethodFn(http.MethodDelete), Doc: "sends a DELETE request"},
+			// http.request("PATCH", "https://api.example.com/users/1", {"json": {"name": "Jane"}})
+			"request": {Fn: httpRequestFn, Doc: "sends a request with the given method"},
+			// http.serve(":8080", f(req) { ... }) or http.serve(":8080", {"GET /users/{id}": f(req) { ... }})
+			"serve": {Fn: httpServeFn, Doc: "serves HTTP requests through a function, or functions routed by method and path"},
+		},
+	}
+}
+
+// Builds an hash holding the functions of a module,
+// so that they can be called as module.fn(...)
+func builtinModule(tok token.Token, fns map[string]*object.Builtin) *object.Hash {
+	names := []string{}
+	for name := range fns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := []object.HashPair{}
+	for _, name := range names {
+		pairs = append(pairs, object.HashPair{Key: &object.String{Token: tok, Value: name}, Value: fns[name]})
 	}
+
+	return object.NewHashFromPairs(tok, pairs)
 }
 
 /*
@@ -527,12 +806,37 @@ Here be the actual Builtin Functions
 // Utility function that validates arguments passed to builtin functions.
 func validateArgs(tok token.Token, name string, args []object.Object, size int, types [][]string) object.Object {
 	if len(args) == 0 || len(args) > size || len(args) < size {
-		return newError(tok, "wrong number of arguments to %s(...): got=%d, want=%d", name, len(args), size)
+		return newKindError(tok, object.ARGUMENT_ERROR, "wrong number of arguments to %s(...): got=%d, want=%d", name, len(args), size)
 	}
 
 	for i, t := range types {
 		if !util.Contains(t, string(args[i].Type())) && !util.Contains(t, object.ANY_OBJ) {
-			return newError(tok, "argument %d to %s(...) is not supported (got: %s, allowed: %s)", i, name, args[i].Inspect(), strings.Join(t, ", "))
+			return newKindError(tok, object.ARGUMENT_ERROR, "argument %d to %s(...) is not supported (got: %s, allowed: %s)", i, name, args[i].Inspect(), strings.Join(t, ", "))
+		}
+	}
+
+	return nil
+}
+
+// validateOptions validates the options passed to builtin
+// functions through an hash, such as {"indent": 2}: spec
+// maps each option to the types it supports.
+func validateOptions(tok token.Token, name string, options *object.Hash, spec map[string][]string) object.Object {
+	for _, pair := range options.OrderedPairs() {
+		types, ok := spec[pair.Key.Inspect()]
+
+		if !ok || pair.Key.Type() != object.STRING_OBJ {
+			allowed := []string{}
+			for option := range spec {
+				allowed = append(allowed, option)
+			}
+			sort.Strings(allowed)
+
+			return newKindError(tok, object.ARGUMENT_ERROR, "unknown option '%s' to %s(...) (allowed: %s)", pair.Key.Inspect(), name, strings.Join(allowed, ", "))
+		}
+
+		if !util.Contains(types, string(pair.Value.Type())) {
+			return newKindError(tok, object.ARGUMENT_ERROR, "option '%s' to %s(...) is not supported (got: %s, allowed: %s)", pair.Key.Inspect(), name, pair.Value.Inspect(), strings.Join(types, ", "))
 		}
 	}
 
@@ -565,7 +869,7 @@ func validateVarArgs(tok token.Token, name string, args []object.Object, specs [
 	}
 
 	if len(args) < required || len(args) > max {
-		return newError(tok, "wrong number of arguments to %s(...): got=%d, min=%d, max=%d", name, len(args), required, max), -1
+		return newKindError(tok, object.ARGUMENT_ERROR, "wrong number of arguments to %s(...): got=%d, min=%d, max=%d", name, len(args), required, max), -1
 	}
 
 	for which, spec := range specs {
@@ -577,7 +881,7 @@ func validateVarArgs(tok token.Token, name string, args []object.Object, specs [
 		// do the caller's args match this spec?
 		match := true
 		for i, types := range spec {
-			if i < len(args) && !util.Contains(types, string(args[i].Type())) {
+			if i < len(args) && !util.Contains(types, string(args[i].Type())) && !util.Contains(types, object.ANY_OBJ) {
 				match = false
 				break
 			}
@@ -590,7 +894,7 @@ func validateVarArgs(tok token.Token, name string, args []object.Object, specs [
 	}
 
 	// no signature specs matched
-	return newError(tok, "%s", usageVarArgs(name, specs)), -1
+	return newKindError(tok, object.ARGUMENT_ERROR, "%s", usageVarArgs(name, specs)), -1
 }
 
 func usageVarArgs(name string, specs [][][]string) string {
@@ -664,9 +968,69 @@ func exitFn(tok token.Token, env *object.Environment, args ...object.Object) obj
 		fmt.Fprint(env.Stdio.Stdout, message)
 	}
 
-	arg := args[0].(*object.Number)
-	os.Exit(int(arg.Value))
-	return arg
+	// Rather than exiting right away, we stop
+	// the script as if an error was raised, so
+	// that deferred code and at_exit(...)
+	// functions get to run
+	return newExitError(tok, args[0].(*object.Number).Int())
+}
+
+// on_signal("INT", f(sig) { ... }) or on_signal("INT", null)
+// Registers the function to run when the script receives
+// the signal, instead of being terminated. null restores
+// the default behavior of the signal.
+func onSignalFn(tok token.Token, env *object.Environment, args ...object.Object) object.Object {
+	err := validateArgs(tok, "on_signal", args, 2, [][]string{{object.STRING_OBJ}, {object.FUNCTION_OBJ, object.NULL_OBJ}})
+	if err != nil {
+		return err
+	}
+
+	name := args[0].(*object.String).Value
+	sig, ok := object.ParseSignal(name)
+	if !ok {
+		return newKindError(tok, object.ARGUMENT_ERROR, "unknown signal %s (valid signals are %s)", name, strings.Join(object.SignalNames(), ", "))
+	}
+
+	// These can't be caught by any process
+	if n := object.SignalName(sig); n == "KILL" || n == "STOP" {
+		return newKindError(tok, object.ARGUMENT_ERROR, "signal %s cannot be handled", name)
+	}
+
+	if args[1] == NULL {
+		env.Traps.OnSignal(sig, nil)
+		return NULL
+	}
+
+	env.Traps.OnSignal(sig, &object.Trap{Token: tok, Handler: args[1], Signal: object.SignalName(sig)})
+	return NULL
+}
+
+// at_exit(f() { ... })
+// Registers a function to run when the script exits,
+// whether it's over, it called exit(...) or it was
+// stopped by an error.
+func atExitFn(tok token.Token, env *object.Environment, args ...object.Object) object.Object {
+	err := validateArgs(tok, "at_exit", args, 1, [][]string{{object.FUNCTION_OBJ}})
+	if err != nil {
+		return err
+	}
+
+	env.Traps.AtExit(&object.Trap{Token: tok, Handler: args[0]})
+	return NULL
+}
+
+// strict() or strict(false)
+func strictFn(tok token.Token, env *object.Environment, args ...object.Object) object.Object {
+	err, spec := validateVarArgs(tok, "strict", args, [][][]string{
+		{},
+		{{object.BOOLEAN_OBJ}},
+	})
+	if err != nil {
+		return err
+	}
+
+	env.Settings.Strict = spec == 0 || args[0].(*object.Boolean).Value
+	return NULL
 }
 
 // unix_ms()
@@ -857,6 +1221,18 @@ func intFn(tok token.Token, env *object.Environment, args ...object.Object) obje
 		return err
 	}
 
+	// Integers are kept exact, no matter how large
+	// they are: int("9007199254740993") won't lose
+	// precision
+	switch arg := args[0].(type) {
+	case *object.Number:
+		return object.NewBigNumber(tok, arg.BigInt())
+	case *object.String:
+		if i, ok := new(big.Int).SetString(strings.TrimSpace(arg.Value), 10); ok {
+			return object.NewBigNumber(tok, i)
+		}
+	}
+
 	return applyMathFunction(tok, args[0], func(n float64) float64 {
 		return float64(int64(n))
 	}, "int")
@@ -952,6 +1328,13 @@ func numberFn(tok token.Token, env *object.Environment, args ...object.Object) o
 			return newError(tok, "number(...) can only be called on strings which represent numbers, '%s' given", arg.Value)
 		}
 
+		// Large integers are kept exact
+		if math.Abs(i) >= object.MaxExactInt {
+			if b, ok := new(big.Int).SetString(arg.Value, 10); ok {
+				return object.NewBigNumber(tok, b)
+			}
+		}
+
 		return &object.Number{Token: tok, Value: i}
 	default:
 		// we will never reach here
@@ -1063,6 +1446,30 @@ func typeFn(tok token.Token, env *object.Environment, args ...object.Object) obj
 	return &object.String{Token: tok, Value: string(args[0].Type())}
 }
 
+// error("something went wrong")
+// error("file not found", "IOError")
+func errorFn(tok token.Token, env *object.Environment, args ...object.Object) object.Object {
+	err, spec := validateVarArgs(tok, "error", args, [][][]string{
+		{{object.STRING_OBJ}, {object.STRING_OBJ}},
+		{{object.STRING_OBJ}},
+	})
+	if err != nil {
+		return err
+	}
+
+	kind := object.GENERIC_ERROR
+	if spec == 0 {
+		kind = args[1].(*object.String).Value
+	}
+
+	// The error is a regular value until
+	// someone decides to throw it
+	e := newKindError(tok, kind, "%s", args[0].(*object.String).Value)
+	e.Caught = true
+
+	return e
+}
+
 // fn.call(args_array)
 func callFn(tok token.Token, env *object.Environment, args ...object.Object) object.Object {
 	err := validateArgs(tok, "call", args, 2, [][]string{{object.FUNCTION_OBJ, object.BUILTIN_OBJ}, {object.ARRAY_OBJ}})
@@ -1164,70 +1571,69 @@ func linesFn(tok token.Token, env *object.Environment, args ...object.Object) ob
 // "{}".json()
 // Converts a valid JSON document to an ABS hash.
 func jsonFn(tok token.Token, env *object.Environment, args ...object.Object) object.Object {
-	// One interesting thing here is that we're creating
-	// a new environment from scratch, whereas it might
-	// be interesting to use the existing one. That would
-	// allow to do things like:
-	//
-	// x = 10
-	// '{"key": x}'.json()["key"] // 10
-	//
-	// Also, we're instantiating a new lexer & parser from
-	// scratch, so this is a tad slow.
-
 	err := validateArgs(tok, "json", args, 1, [][]string{{object.STRING_OBJ}})
 	if err != nil {
 		return err
 	}
 
 	s := args[0].(*object.String)
-	str := strings.TrimSpace(s.Value)
-	env = object.NewEnvironment(object.SystemStdio, env.Dir, env.Version, env.Interactive)
-	l := lexer.New(str)
-	p := parser.New(l)
-	var node ast.Node
-	ok := false
 
-	// JSON types:
-	// - objects
-	// - arrays
-	// - number
-	// - string
-	// - null
-	// - bool
-	if len(str) != 0 {
-		switch str[0] {
-		case '{':
-			node, ok = p.ParseHashLiteral().(*ast.HashLiteral)
-		case '[':
-			node, ok = p.ParseArrayLiteral().(*ast.ArrayLiteral)
-		}
+	// For BC, an empty document is
+	// considered to be an empty string
+	if strings.TrimSpace(s.Value) == "" {
+		return &object.String{Token: tok, Value: ""}
 	}
 
-	// if str is empty, the length will be 0
-	// we can parse it the same way as string literal
-	if len(str) == 0 || (str[0] == '"' && str[len(str)-1] == '"') {
-		node, ok = p.ParseStringLiteral().(*ast.StringLiteral)
+	value, decodeErr := object.DecodeJson(s.Value)
+	if decodeErr != nil {
+		return newError(tok, "argument to `json` must be a valid JSON document: %s", decodeErr.Error())
 	}
 
-	if util.IsNumber(str) {
-		node, ok = p.ParseNumberLiteral().(*ast.NumberLiteral)
-	}
+	return value
+}
 
-	if str == "false" || str == "true" {
-		node, ok = p.ParseBoolean().(*ast.Boolean)
+// json_encode({"a": 1}, {"indent": 2, "sort_keys": true})
+// Converts a value to a JSON document.
+func jsonEncodeFn(tok token.Token, env *object.Environment, args ...object.Object) object.Object {
+	err, spec := validateVarArgs(tok, "json_encode", args, [][][]string{
+		{{object.ANY_OBJ}},
+		{{object.ANY_OBJ}, {object.HASH_OBJ}},
+	})
+	if err != nil {
+		return err
 	}
 
-	if str == "null" {
-		return NULL
-	}
+	indent := ""
+	sortKeys := false
 
-	if ok {
-		return Eval(node, env)
-	}
+	if spec == 1 {
+		options := args[1].(*object.Hash)
+		err := validateOptions(tok, "json_encode", options, map[string][]string{
+			"indent":    {object.NUMBER_OBJ, object.STRING_OBJ},
+			"sort_keys": {object.BOOLEAN_OBJ},
+		})
+		if err != nil {
+			return err
+		}
+
+		if pair, ok := options.GetPair("indent"); ok {
+			switch i := pair.Value.(type) {
+			case *object.String:
+				indent = i.Value
+			case *object.Number:
+				if i.Value < 0 || !i.IsInt() {
+					return newKindError(tok, object.ARGUMENT_ERROR, "the indent option to json_encode(...) must be a positive integer or a string, got %s", i.Inspect())
+				}
+				indent = strings.Repeat(" ", i.Int())
+			}
+		}
 
-	return newError(tok, "argument to `json` must be a valid JSON object, got '%s'", s.Value)
+		if pair, ok := options.GetPair("sort_keys"); ok {
+			sortKeys = pair.Value.(*object.Boolean).Value
+		}
+	}
 
+	return &object.String{Token: tok, Value: object.EncodeJson(args[0], indent, sortKeys)}
 }
 
 // "a %s".fmt(b)
@@ -1354,12 +1760,17 @@ func reduceFn(tok token.Token, env *object.Environment, args ...object.Object) o
 }
 
 // sort(array:[1, 2, 3])
+// sort(hash:{"b": 1, "a": 2})
 func sortFn(tok token.Token, env *object.Environment, args ...object.Object) object.Object {
-	err := validateArgs(tok, "sort", args, 1, [][]string{{object.ARRAY_OBJ}})
+	err := validateArgs(tok, "sort", args, 1, [][]string{{object.ARRAY_OBJ, object.HASH_OBJ}})
 	if err != nil {
 		return err
 	}
 
+	if hash, ok := args[0].(*object.Hash); ok {
+		return sortHash(tok, hash)
+	}
+
 	arr := args[0].(*object.Array)
 	elements := arr.Elements
 
@@ -1403,6 +1814,29 @@ func sortFn(tok token.Token, env *object.Environment, args ...object.Object) obj
 	}
 }
 
+// sortHash returns a copy of the hash with its keys
+// sorted: keys are grouped by type, numbers are sorted
+// numerically and everything else alphabetically.
+func sortHash(tok token.Token, hash *object.Hash) object.Object {
+	pairs := hash.OrderedPairs()
+
+	sort.SliceStable(pairs, func(i, j int) bool {
+		a, b := pairs[i].Key, pairs[j].Key
+
+		if a.Type() != b.Type() {
+			return a.Type() < b.Type()
+		}
+
+		if a, ok := a.(*object.Number); ok {
+			return a.BigFloat().Cmp(b.(*object.Number).BigFloat()) < 0
+		}
+
+		return a.Inspect() < b.Inspect()
+	})
+
+	return object.NewHashFromPairs(tok, pairs)
+}
+
 // intersect(array:[1, 2, 3], array:[1, 2, 3])
 func intersectFn(tok token.Token, env *object.Environment, args ...object.Object) object.Object {
 	err := validateArgs(tok, "intersect", args, 2, [][]string{{object.ARRAY_OBJ}, {object.ARRAY_OBJ}})
@@ -1670,7 +2104,7 @@ func findFn(tok token.Token, env *object.Environment, args ...object.Object) obj
 
 			match := true
 			for k, pair := range predicate.Pairs {
-				toCompare, ok := v.GetPair(k.Value)
+				toCompare, ok := v.Pairs[k]
 				if !ok {
 					match = false
 					continue
@@ -1894,7 +2328,10 @@ func waitFn(tok token.Token, env *object.Environment, args ...object.Object) obj
 		return cmd
 	}
 
+	resume := yield()
 	cmd.Wait()
+	resume()
+
 	return cmd
 }
 
@@ -1916,6 +2353,105 @@ func killFn(tok token.Token, env *object.Environment, args ...object.Object) obj
 	if errCmdKill != nil {
 		return newError(tok, "Error killing command %s with error %s", cmd.Inspect(), errCmdKill.Error())
 	}
+
+	// Once killed, the command is done as
+	// soon as its result is recorded
+	cmd.Wait()
+	return cmd
+}
+
+// signal(`sleep 10 &`, "TERM")
+func signalFn(tok token.Token, env *object.Environment, args ...object.Object) object.Object {
+	err := validateArgs(tok, "signal", args, 2, [][]string{{object.STRING_OBJ}, {object.STRING_OBJ, object.NUMBER_OBJ}})
+	if err != nil {
+		return err
+	}
+
+	cmd := args[0].(*object.String)
+
+	if cmd.Cmd == nil || cmd.Cmd.Process == nil {
+		return newKindError(tok, object.ARGUMENT_ERROR, "signal(...) can only be sent to a command that was started, got '%s'", cmd.Inspect())
+	}
+
+	sig, ok := object.ParseSignal(args[1].Inspect())
+	if !ok {
+		return newKindError(tok, object.ARGUMENT_ERROR, "unknown signal '%s' (allowed: %s)", args[1].Inspect(), strings.Join(object.SignalNames(), ", "))
+	}
+
+	errSignal := cmd.Signal(sig)
+	if errSignal != nil {
+		return newError(tok, "Error sending signal %s to command %s with error %s", args[1].Inspect(), cmd.Inspect(), errSignal.Error())
+	}
+
+	return cmd
+}
+
+// jobs()
+func jobsFn(tok token.Token, env *object.Environment, args ...object.Object) object.Object {
+	jobs := []object.Object{}
+	for _, job := range env.Jobs.List() {
+		jobs = append(jobs, jobToHash(tok, job))
+	}
+
+	return &object.Array{Token: tok, Elements: jobs}
+}
+
+// Jobs are listed as hashes, such as:
+// {"pid": 123, "command": "sleep 10", "state": "running", "started": 1546300800000, "cmd": ...}
+func jobToHash(tok token.Token, job *object.Job) *object.Hash {
+	return object.NewHashFromPairs(tok, []object.HashPair{
+		{Key: &object.String{Token: tok, Value: "pid"}, Value: &object.Number{Token: tok, Value: float64(job.Cmd.Cmd.Process.Pid)}},
+		{Key: &object.String{Token: tok, Value: "command"}, Value: &object.String{Token: tok, Value: job.Command}},
+		{Key: &object.String{Token: tok, Value: "state"}, Value: &object.String{Token: tok, Value: job.State()}},
+		{Key: &object.String{Token: tok, Value: "started"}, Value: &object.Number{Token: tok, Value: float64(job.Cmd.Started.UnixMilli())}},
+		{Key: &object.String{Token: tok, Value: "cmd"}, Value: job.Cmd},
+	})
+}
+
+// wait_all()
+func waitAllFn(tok token.Token, env *object.Environment, args ...object.Object) object.Object {
+	cmds := []object.Object{}
+	resume := yield()
+	for _, job := range env.Jobs.Running() {
+		job.Cmd.Wait()
+		cmds = append(cmds, job.Cmd)
+	}
+	resume()
+
+	return &object.Array{Token: tok, Elements: cmds}
+}
+
+// wait_any([`sleep 1 &`, `sleep 2 &`])
+func waitAnyFn(tok token.Token, env *object.Environment, args ...object.Object) object.Object {
+	err := validateArgs(tok, "wait_any", args, 1, [][]string{{object.ARRAY_OBJ}})
+	if err != nil {
+		return err
+	}
+
+	elements := args[0].(*object.Array).Elements
+	if len(elements) == 0 {
+		return newKindError(tok, object.ARGUMENT_ERROR, "wait_any(...) needs at least one command to wait for")
+	}
+
+	cases := []reflect.SelectCase{}
+	for _, e := range elements {
+		cmd, ok := e.(*object.String)
+		if !ok || cmd.Cmd == nil {
+			return newKindError(tok, object.ARGUMENT_ERROR, "wait_any(...) can only wait for commands, got '%s'", e.Inspect())
+		}
+
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(cmd.Finished())})
+	}
+
+	resume := yield()
+	i, _, _ := reflect.Select(cases)
+	cmd := elements[i].(*object.String)
+
+	// Make sure the command is fully done
+	// before handing it back
+	cmd.Wait()
+	resume()
+
 	return cmd
 }
 
@@ -2111,14 +2647,17 @@ func popFn(tok token.Token, env *object.Environment, args ...object.Object) obje
 		}
 	case *object.Hash:
 		if len(args) == 2 {
-			key := args[1].(object.Hashable)
+			key, ok := args[1].(object.Hashable)
+			if !ok {
+				return newKindError(tok, object.TYPE_ERROR, "unusable as hash key: %s", args[1].Type())
+			}
 			hashKey := key.HashKey()
 			item, ok := arg.Pairs[hashKey]
 			if ok {
-				pairs := make(map[object.HashKey]object.HashPair)
-				pairs[hashKey] = item
-				delete(arg.Pairs, hashKey)
-				return &object.Hash{Pairs: pairs}
+				arg.Delete(hashKey)
+				popped := &object.Hash{}
+				popped.Set(hashKey, item)
+				return popped
 			}
 		}
 	}
@@ -2141,9 +2680,8 @@ func keysFn(tok token.Token, env *object.Environment, args ...object.Object) obj
 		}
 		return &object.Array{Elements: newElements}
 	case *object.Hash:
-		pairs := arg.Pairs
 		keys := []object.Object{}
-		for _, pair := range pairs {
+		for _, pair := range arg.OrderedPairs() {
 			key := pair.Key
 			keys = append(keys, key)
 		}
@@ -2159,9 +2697,8 @@ func valuesFn(tok token.Token, env *object.Environment, args ...object.Object) o
 		return err
 	}
 	hash := args[0].(*object.Hash)
-	pairs := hash.Pairs
 	values := []object.Object{}
-	for _, pair := range pairs {
+	for _, pair := range hash.OrderedPairs() {
 		value := pair.Value
 		values = append(values, value)
 	}
@@ -2175,9 +2712,8 @@ func itemsFn(tok token.Token, env *object.Environment, args ...object.Object) ob
 		return err
 	}
 	hash := args[0].(*object.Hash)
-	pairs := hash.Pairs
 	items := []object.Object{}
-	for _, pair := range pairs {
+	for _, pair := range hash.OrderedPairs() {
 		key := pair.Key
 		value := pair.Value
 		item := &object.Array{Elements: []object.Object{key, value}}
@@ -2219,7 +2755,9 @@ func sleepFn(tok token.Token, env *object.Environment, args ...object.Object) ob
 	}
 
 	ms := args[0].(*object.Number)
+	resume := yield()
 	time.Sleep(time.Duration(ms.Value) * time.Millisecond)
+	resume()
 
 	return NULL
 }
@@ -2268,12 +2806,15 @@ func requireFn(tok token.Token, env *object.Environment, args ...object.Object)
 	}
 
 	e := object.NewEnvironment(object.SystemStdio, filepath.Dir(file), env.Version, env.Interactive)
+	e.Jobs = env.Jobs
+	e.Traps = env.Traps
+	e.SetSettings(env.Settings)
 	evaluated := doSource(tok, e, file, args...)
 
-	// If a module fails to be imported, let's
-	// not cache the result
+	// If a module fails to be imported, or exits,
+	// let's not cache the result
 	switch ret := evaluated.(type) {
-	case *object.Error:
+	case *object.Error, *object.ExitError:
 		return ret
 	default:
 		requireCache[file] = evaluated
@@ -2298,10 +2839,7 @@ func doSource(tok token.Token, env *object.Environment, fileName string, args ..
 	if sourceLevel >= sourceDepth {
 		// reset the source level
 		sourceLevel = 0
-		// use errObj.Message instead of errObj.Inspect() to avoid nested "ERROR: " prefixes
-		errObj := newError(tok, "maximum source file inclusion depth exceeded at %d levels", sourceDepth)
-		errObj = &object.Error{Message: errObj.Message}
-		return errObj
+		return newKindError(tok, object.IMPORT_ERROR, "maximum source file inclusion depth exceeded at %d levels", sourceDepth)
 	}
 	// mark this source level
 	sourceLevel++
@@ -2322,7 +2860,7 @@ func doSource(tok token.Token, env *object.Environment, fileName string, args ..
 		// reset the source level
 		sourceLevel = 0
 		// cannot read source file
-		return newError(tok, "cannot read source file: %s:\n%s", fileName, error.Error())
+		return newKindError(tok, object.IMPORT_ERROR, "cannot read source file: %s:\n%s", fileName, error.Error())
 	}
 	// parse it
 	l := lexer.New(string(code))
@@ -2336,20 +2874,27 @@ func doSource(tok token.Token, env *object.Environment, fileName string, args ..
 		for _, msg := range errors {
 			errMsg += fmt.Sprintf("%s", "\t"+msg+"\n")
 		}
-		return newError(tok, "error found in source file: %s\n%s", fileName, errMsg)
+		return newKindError(tok, object.IMPORT_ERROR, "error found in source file: %s\n%s", fileName, errMsg)
 	}
 	// invoke BeginEval() passing in the sourced program, env, and our lexer
 	// we save the current global lexer and restore it after we return from BeginEval()
 	// NB. saving the lexer allows error line numbers to be relative to any nested source files
-	savedLexer := lex
+	// the same goes for the file we're reading code from
+	savedLexer, savedFile := lex, lexFile
+	savedEnvFile := env.File
+	env.File = fileName
+	// the sourced code shows up in stack traces
+	// as called from here
+	callStack = append(callStack, call{function: mainFrame, tok: tok, lex: lex, file: lexFile})
 	evaluated := BeginEval(program, env, l)
-	lex = savedLexer
-	if evaluated != nil && evaluated.Type() == object.ERROR_OBJ {
-		// use errObj.Message instead of errObj.Inspect() to avoid nested "ERROR: " prefixes
-		evalErrMsg := evaluated.(*object.Error).Message
-		sourceErrMsg := newError(tok, "error found in eval block: %s", fileName).Message
-		errObj := &object.Error{Message: fmt.Sprintf("%s\n\t%s", sourceErrMsg, evalErrMsg)}
-		return errObj
+	callStack = callStack[:len(callStack)-1]
+	lex, lexFile = savedLexer, savedFile
+	env.File = savedEnvFile
+	if exit, ok := evaluated.(*object.ExitError); ok {
+		return exit
+	}
+	if isError(evaluated) {
+		return wrapError(tok, evaluated.(*object.Error), "error found in eval block: %s", fileName)
 	}
 	// restore this source level
 	sourceLevel--
@@ -2382,12 +2927,11 @@ func evalFn(tok token.Token, env *object.Environment, args ...object.Object) obj
 	evaluated := BeginEval(program, env, l)
 	lex = savedLexer
 
-	if evaluated != nil && evaluated.Type() == object.ERROR_OBJ {
-		// use errObj.Message instead of errObj.Inspect() to avoid nested "ERROR: " prefixes
-		evalErrMsg := evaluated.(*object.Error).Message
-		sourceErrMsg := newError(tok, "error found in eval block: %s", args[0].Inspect()).Message
-		errObj := &object.Error{Message: fmt.Sprintf("%s\n\t%s", sourceErrMsg, evalErrMsg)}
-		return errObj
+	if exit, ok := evaluated.(*object.ExitError); ok {
+		return exit
+	}
+	if isError(evaluated) {
+		return wrapError(tok, evaluated.(*object.Error), "error found in eval block: %s", args[0].Inspect())
 	}
 
 	return evaluated
@@ -2450,30 +2994,42 @@ func tsvFn(tok token.Token, env *object.Environment, args ...object.Object) obje
 	}
 
 	headerObj := args[2].(*object.Array)
-	header := []string{}
+	header := []object.Object{}
 
 	if len(headerObj.Elements) > 0 {
-		for _, v := range headerObj.Elements {
-			header = append(header, v.Inspect())
-		}
+		header = headerObj.Elements
 	} else if isHash {
 		// if our array is made of hashes, we will include a header in
 		// our TSV output, made of all possible keys found in every object
+		seen := map[object.HashKey]bool{}
 		for _, rows := range array.Elements {
-			for _, pair := range rows.(*object.Hash).Pairs {
-				header = append(header, pair.Key.Inspect())
+			for hashKey, pair := range rows.(*object.Hash).Pairs {
+				if !seen[hashKey] {
+					seen[hashKey] = true
+					header = append(header, pair.Key)
+				}
 			}
 		}
 
 		// When no header is provided, we will simply
 		// use the list of keys from all object, alphabetically
 		// sorted
-		header = util.UniqueStrings(header)
-		sort.Strings(header)
+		sort.SliceStable(header, func(i, j int) bool {
+			if header[i].Inspect() == header[j].Inspect() {
+				return header[i].Type() < header[j].Type()
+			}
+
+			return header[i].Inspect() < header[j].Inspect()
+		})
 	}
 
 	if len(header) > 0 {
-		err := tsv.Write(header)
+		columns := []string{}
+		for _, v := range header {
+			columns = append(columns, v.Inspect())
+		}
+
+		err := tsv.Write(columns)
 
 		if err != nil {
 			return newError(tok, "%s", err.Error())
@@ -2499,13 +3055,12 @@ func tsvFn(tok token.Token, env *object.Environment, args ...object.Object) obje
 		// simply set it to null
 		if isHash {
 			for _, key := range header {
-				pair, ok := row.(*object.Hash).GetPair(key)
-				var value object.Object
+				var value object.Object = NULL
 
-				if ok {
-					value = pair.Value
-				} else {
-					value = NULL
+				if hashable, ok := key.(object.Hashable); ok {
+					if pair, ok := row.(*object.Hash).Pairs[hashable.HashKey()]; ok {
+						value = pair.Value
+					}
 				}
 
 				values = append(values, value.Inspect())
@@ -2525,16 +3080,34 @@ func tsvFn(tok token.Token, env *object.Environment, args ...object.Object) obje
 	return &object.String{Value: strings.TrimSpace(out.String())}
 }
 
+// exec("ls -la") or exec("curl $url", {"timeout": 5000})
 func execFn(tok token.Token, env *object.Environment, args ...object.Object) object.Object {
-	err := validateArgs(tok, "exec", args, 1, [][]string{{object.STRING_OBJ}})
+	err, spec := validateVarArgs(tok, "exec", args, [][][]string{
+		{{object.STRING_OBJ}},
+		{{object.STRING_OBJ}, {object.HASH_OBJ}},
+	})
 	if err != nil {
 		return err
 	}
-	cmd := args[0].Inspect()
-	cmd = strings.Trim(cmd, " ")
+	var cmd string
 
-	// interpolate any $vars in the cmd string
-	cmd = util.InterpolateStringVars(cmd, env)
+	// Commands such as exec(`ls`) are handed over
+	// without being run, with their $vars already
+	// interpolated
+	if c := args[0].(*object.String); c.Cmd != nil && c.Cmd.Process == nil {
+		cmd = c.Command
+		if c.Detached {
+			cmd += " &"
+		}
+	} else {
+		cmd = strings.Trim(c.Inspect(), " ")
+
+		// interpolate any $vars in the cmd string,
+		// quoting them so that they are not
+		// interpreted by the shell
+		cmd = util.InterpolateCommandVars(cmd, env)
+	}
+	traceCall(env, tok, "$ %s", cmd)
 
 	// set up command to execute using our stdIO
 	parts := strings.Split(os.Getenv("ABS_COMMAND_EXECUTOR"), " ")
@@ -2543,14 +3116,1817 @@ func execFn(tok token.Token, env *object.Environment, args ...object.Object) obj
 	c.Stdin = env.Stdio.Stdin
 	c.Stdout = env.Stdio.Stdout
 	c.Stderr = env.Stdio.Stderr
+	// The output of the command isn't captured,
+	// so it's left out of its result
+	s := &object.String{Token: tok, Cmd: c, Command: cmd, Stdout: &bytes.Buffer{}, Stderr: &bytes.Buffer{}}
+
+	if spec == 1 {
+		err := applyCommandOptions(tok, "exec", s, args[1].(*object.Hash))
+		if err != nil {
+			return err
+		}
+	}
+
+	if dryRun(env, s) {
+		return NULL
+	}
 
 	// N.B. that a bash command may end with '&' --
 	// in this case bash will launch it as a daemon process and then exit c.Run() immediately
 	// this may require pkill to terminate the daemon process using the pid
-	runErr := c.Run()
+	resume := yield()
+	runErr := s.RunCmd()
+	resume()
+
+	if runErr != nil && env.Settings.Strict {
+		s.SetCmdResult(FALSE)
+		return newCommandError(s)
+	}
+
+	// The command is returned so that, besides
+	// the message, its .timed_out can be checked
+	if s.TimedOut {
+		s.Stderr.WriteString(fmt.Sprintf("command timed out after %s", s.Timeout))
+		s.SetCmdResult(FALSE)
+		return s
+	}
 
 	if runErr != nil {
 		return &object.String{Value: runErr.Error()}
 	}
 	return NULL
 }
+
+// run(["git", "commit", "-m", message], {"cwd": "/tmp", "env": {"A": "1"}, "stdin": "input", "timeout": 1000})
+// or run(`curl $url`, {"timeout": 5000})
+// Executes a command with the given options. When the command
+// is an array of arguments, it is executed without going through
+// a shell, so that its arguments never need to be quoted.
+func runFn(tok token.Token, env *object.Environment, args ...object.Object) object.Object {
+	err, spec := validateVarArgs(tok, "run", args, [][][]string{
+		{{object.ARRAY_OBJ, object.STRING_OBJ}},
+		{{object.ARRAY_OBJ, object.STRING_OBJ}, {object.HASH_OBJ}},
+	})
+	if err != nil {
+		return err
+	}
+
+	var s *object.String
+
+	switch arg := args[0].(type) {
+	case *object.String:
+		s, err = commandArgument(tok, "run", arg, env)
+		if err != nil {
+			return err
+		}
+	case *object.Array:
+		s, err = argvCommand(tok, "run", arg, env)
+		if err != nil {
+			return err
+		}
+	}
+
+	if spec == 1 {
+		err := applyCommandOptions(tok, "run", s, args[1].(*object.Hash))
+		if err != nil {
+			return err
+		}
+	}
+
+	if dryRun(env, s) {
+		return s
+	}
+
+	resume := yield()
+	runWithResult(s)
+	resume()
+
+	if failsStrictly(env, s) {
+		return newCommandError(s)
+	}
+
+	return s
+}
+
+// run_all([`curl -s a.example.com`, ["ping", "-c", "1", host]], 10)
+// Runs commands concurrently, at most N at a time, and
+// returns their results in the same order as the commands.
+// A failing command doesn't stop the others, not even in
+// strict mode: failures are looked up in the results.
+func runAllFn(tok token.Token, env *object.Environment, args ...object.Object) object.Object {
+	err, spec := validateVarArgs(tok, "run_all", args, [][][]string{
+		{{object.ARRAY_OBJ}},
+		{{object.ARRAY_OBJ}, {object.NUMBER_OBJ}},
+	})
+	if err != nil {
+		return err
+	}
+
+	concurrency := runtime.NumCPU()
+
+	if spec == 1 {
+		n := args[1].(*object.Number)
+		if n.Value < 1 || !n.IsInt() {
+			return newKindError(tok, object.ARGUMENT_ERROR, "the concurrency of run_all(...) must be a positive integer, got %s", n.Inspect())
+		}
+
+		concurrency = n.Int()
+	}
+
+	cmds := []object.Object{}
+	for _, e := range args[0].(*object.Array).Elements {
+		var s *object.String
+
+		switch c := e.(type) {
+		case *object.String:
+			s, err = commandArgument(tok, "run_all", c, env)
+		case *object.Array:
+			s, err = argvCommand(tok, "run_all", c, env)
+		default:
+			return newKindError(tok, object.ARGUMENT_ERROR, "run_all(...) can only run commands, got %s", e.Inspect())
+		}
+
+		if err != nil {
+			return err
+		}
+
+		// Commands running at the same
+		// time cannot share our input
+		s.Cmd.Stdin = nil
+		cmds = append(cmds, s)
+	}
+
+	pending := []object.Object{}
+	for _, cmd := range cmds {
+		if !dryRun(env, cmd.(*object.String)) {
+			pending = append(pending, cmd)
+		}
+	}
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, concurrency)
+
+	resume := yield()
+	for _, cmd := range pending {
+		slots <- struct{}{}
+		wg.Add(1)
+
+		go func(s *object.String) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+
+			runWithResult(s)
+		}(cmd.(*object.String))
+	}
+	wg.Wait()
+	resume()
+
+	return &object.Array{Token: tok, Elements: cmds}
+}
+
+// parallel(hosts, f(host) { `ssh $host uptime` }, {"concurrency": 10})
+// Calls a function on each item concurrently, at most N
+// at a time, and returns what it returned in the same order
+// as the items. Errors raised by the function are returned
+// along with the other results, rather than stopping them.
+//
+// Calls take turns at evaluating code: they only run at
+// the same time while they wait on commands, requests or
+// sleep(...).
+func parallelFn(tok token.Token, env *object.Environment, args ...object.Object) object.Object {
+	err, spec := validateVarArgs(tok, "parallel", args, [][][]string{
+		{{object.ARRAY_OBJ}, {object.FUNCTION_OBJ, object.BUILTIN_OBJ}},
+		{{object.ARRAY_OBJ}, {object.FUNCTION_OBJ, object.BUILTIN_OBJ}, {object.HASH_OBJ}},
+	})
+	if err != nil {
+		return err
+	}
+
+	concurrency := runtime.NumCPU()
+
+	if spec == 1 {
+		options := args[2].(*object.Hash)
+		err := validateOptions(tok, "parallel", options, map[string][]string{
+			"concurrency": {object.NUMBER_OBJ},
+		})
+		if err != nil {
+			return err
+		}
+
+		if pair, ok := options.GetPair("concurrency"); ok {
+			n := pair.Value.(*object.Number)
+			if n.Value < 1 || !n.IsInt() {
+				return newKindError(tok, object.ARGUMENT_ERROR, "the concurrency of parallel(...) must be a positive integer, got %s", n.Inspect())
+			}
+
+			concurrency = n.Int()
+		}
+	}
+
+	items := args[0].(*object.Array).Elements
+	results := make([]object.Object, len(items))
+	from := position{lex, lexFile, callStack}
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, concurrency)
+
+	resume := yield()
+	for i, item := range items {
+		slots <- struct{}{}
+		wg.Add(1)
+
+		go func(i int, item object.Object) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+
+			takeTurn(from, func() {
+				results[i] = applyFunction(tok, args[1], env, []object.Object{item})
+			})
+		}(i, item)
+	}
+	wg.Wait()
+	resume()
+
+	for i, result := range results {
+		switch result := result.(type) {
+		case *object.ExitError:
+			return result
+		case *object.Error:
+			// Errors are handed back as regular
+			// values, as if they had been caught
+			caught := *result
+			caught.Caught = true
+			results[i] = &caught
+		}
+	}
+
+	return &object.Array{Token: tok, Elements: results}
+}
+
+// Builds a command to be run without a shell
+// out of an array of arguments, such as
+// ["git", "commit", "-m", message].
+func argvCommand(tok token.Token, name string, arr *object.Array, env *object.Environment) (*object.String, object.Object) {
+	argv := []string{}
+	for _, e := range arr.Elements {
+		// Commands within the array, such as
+		// run(["echo", `whoami`]), are handed
+		// over without being run, so let's run
+		// them to get their output
+		if cmd, ok := e.(*object.String); ok && cmd.Cmd != nil && cmd.Cmd.Process == nil {
+			traceCommand(env, cmd)
+			e = runCommand(cmd, false, env)
+		}
+
+		switch e.(type) {
+		case *object.String, *object.Number:
+			argv = append(argv, e.Inspect())
+		default:
+			return nil, newKindError(tok, object.ARGUMENT_ERROR, "the command passed to %s(...) must be an array of strings, got %s", name, arr.Inspect())
+		}
+	}
+
+	if len(argv) == 0 {
+		return nil, newKindError(tok, object.ARGUMENT_ERROR, "the command passed to %s(...) cannot be empty", name)
+	}
+
+	c := exec.Command(argv[0], argv[1:]...)
+	c.Env = os.Environ()
+	c.Stdin = env.Stdio.Stdin
+
+	s := newCommand(tok, c)
+
+	quoted := []string{}
+	for _, arg := range argv {
+		quoted = append(quoted, util.ShellQuote(arg))
+	}
+	s.Command = strings.Join(quoted, " ")
+	traceCommand(env, s)
+
+	return s, nil
+}
+
+// Runs a command, waiting for it to
+// finish and recording its result.
+func runWithResult(s *object.String) {
+	s.Started = time.Now()
+	runErr := s.RunCmd()
+
+	// If the command could not be started (eg. it does
+	// not exist) we report why, just like a shell would
+	if runErr != nil && s.Cmd.Process == nil {
+		s.Stderr.WriteString(runErr.Error())
+	}
+
+	if runErr != nil {
+		s.SetCmdResult(FALSE)
+	} else {
+		s.SetCmdResult(TRUE)
+	}
+}
+
+// Returns the command to be run by functions such as
+// run(`cmd`) or stream(`cmd`). The command is normally
+// handed over without being run, while plain strings,
+// such as run("ls"), are turned into a command.
+func commandArgument(tok token.Token, name string, s *object.String, env *object.Environment) (*object.String, object.Object) {
+	if s.Cmd == nil {
+		s, _ = prepareCommand(tok, s.Value, env)
+	}
+
+	if s.Cmd.Process != nil {
+		return nil, newKindError(tok, object.ARGUMENT_ERROR, "the command passed to %s(...) has already been run, pass it directly instead: %s(`cmd`)", name, name)
+	}
+
+	traceCommand(env, s)
+	return s, nil
+}
+
+// Applies the options accepted by functions that run
+// commands, such as run(`cmd`, {"timeout": 1000}):
+//
+// * cwd: the directory to run the command in
+// * env: variables to set, or unset when null
+// * stdin: the input of the command
+// * timeout: how long, in ms, the command can run for
+func applyCommandOptions(tok token.Token, name string, s *object.String, options *object.Hash) object.Object {
+	err := validateOptions(tok, name, options, map[string][]string{
+		"cwd":     {object.STRING_OBJ},
+		"env":     {object.HASH_OBJ},
+		"stdin":   {object.STRING_OBJ},
+		"timeout": {object.NUMBER_OBJ},
+		"safe":    {object.BOOLEAN_OBJ},
+	})
+	if err != nil {
+		return err
+	}
+
+	if pair, ok := options.GetPair("cwd"); ok {
+		s.Cmd.Dir = pair.Value.Inspect()
+	}
+
+	if pair, ok := options.GetPair("env"); ok {
+		for _, v := range pair.Value.(*object.Hash).OrderedPairs() {
+			key := v.Key.Inspect()
+			environment := []string{}
+
+			for _, e := range s.Cmd.Env {
+				if !strings.HasPrefix(e, key+"=") {
+					environment = append(environment, e)
+				}
+			}
+
+			if v.Value != NULL {
+				environment = append(environment, key+"="+v.Value.Inspect())
+			}
+
+			s.Cmd.Env = environment
+		}
+	}
+
+	if pair, ok := options.GetPair("stdin"); ok {
+		s.Cmd.Stdin = strings.NewReader(pair.Value.Inspect())
+	}
+
+	if pair, ok := options.GetPair("timeout"); ok {
+		timeout := pair.Value.(*object.Number).Value
+		if timeout <= 0 {
+			return newKindError(tok, object.ARGUMENT_ERROR, "the timeout option to %s(...) must be a positive number of milliseconds, got %s", name, pair.Value.Inspect())
+		}
+
+		s.Timeout = time.Duration(timeout * float64(time.Millisecond))
+	}
+
+	if pair, ok := options.GetPair("safe"); ok {
+		s.Safe = pair.Value.(*object.Boolean).Value
+	}
+
+	return nil
+}
+
+// for line in stream(`tail -f app.log`) { ... }
+// Starts a command without waiting for it, so
+// that its output can be read line by line as
+// the command writes it.
+func streamFn(tok token.Token, env *object.Environment, args ...object.Object) object.Object {
+	err, spec := validateVarArgs(tok, "stream", args, [][][]string{
+		{{object.STRING_OBJ}},
+		{{object.STRING_OBJ}, {object.HASH_OBJ}},
+	})
+	if err != nil {
+		return err
+	}
+
+	s, err := commandArgument(tok, "stream", args[0].(*object.String), env)
+	if err != nil {
+		return err
+	}
+
+	// The output of a streamed command is read
+	// as it's written, so it cannot be left to
+	// run in background
+	if s.Detached {
+		return newKindError(tok, object.ARGUMENT_ERROR, "stream(...) cannot run commands in background, remove the trailing '&' from `%s &`", s.Command)
+	}
+
+	if spec == 1 {
+		err := applyCommandOptions(tok, "stream", s, args[1].(*object.Hash))
+		if err != nil {
+			return err
+		}
+	}
+
+	if dryRun(env, s) {
+		s.Lines = bufio.NewReader(strings.NewReader(""))
+		return s
+	}
+
+	// We read the output through a pipe rather
+	// than buffering it
+	s.Cmd.Stdout = nil
+	stdout, pipeErr := s.Cmd.StdoutPipe()
+	if pipeErr != nil {
+		return newError(tok, "%s", pipeErr.Error())
+	}
+
+	s.SetRunning()
+	s.Started = time.Now()
+	s.Lines = bufio.NewReader(stdout)
+
+	// If the command cannot be started, the
+	// stream will simply be empty and report
+	// the error once it's over
+	if startErr := s.StartCmd(); startErr != nil {
+		s.Stderr.WriteString(startErr.Error())
+		s.Lines = bufio.NewReader(strings.NewReader(""))
+		return s
+	}
+
+	// If the loop reading the stream is left early,
+	// the command keeps running: as a job, it won't
+	// outlive the script
+	env.Jobs.Add(s.Command, s)
+
+	return s
+}
+
+// Returns the error raised when a
+// filesystem operation fails, such as
+// "open x: no such file or directory"
+func newIOError(tok token.Token, err error) *object.Error {
+	return newKindError(tok, object.IO_ERROR, "%s", err.Error())
+}
+
+// Returns the path passed to a filesystem
+// function, resolving a leading "~/" to
+// the user's home directory
+func pathArgument(arg object.Object) string {
+	path, _ := util.ExpandPath(arg.(*object.String).Value)
+	return path
+}
+
+// read_file("/etc/hosts")
+func readFileFn(tok token.Token, env *object.Environment, args ...object.Object) object.Object {
+	err := validateArgs(tok, "read_file", args, 1, [][]string{{object.STRING_OBJ}})
+	if err != nil {
+		return err
+	}
+
+	content, readErr := os.ReadFile(pathArgument(args[0]))
+	if readErr != nil {
+		return newIOError(tok, readErr)
+	}
+
+	return &object.String{Token: tok, Value: string(content)}
+}
+
+// write_file("config.json", content) or
+// write_file("config.json", content, {"atomic": true})
+// An atomic write first writes to a temporary file, then
+// moves it over the destination, so that the file is
+// never seen half-written.
+func writeFileFn(tok token.Token, env *object.Environment, args ...object.Object) object.Object {
+	err, spec := validateVarArgs(tok, "write_file", args, [][][]string{
+		{{object.STRING_OBJ}, {object.STRING_OBJ}},
+		{{object.STRING_OBJ}, {object.STRING_OBJ}, {object.HASH_OBJ}},
+	})
+	if err != nil {
+		return err
+	}
+
+	atomic := false
+	if spec == 1 {
+		options := args[2].(*object.Hash)
+		err := validateOptions(tok, "write_file", options, map[string][]string{
+			"atomic": {object.BOOLEAN_OBJ},
+		})
+		if err != nil {
+			return err
+		}
+
+		if pair, ok := options.GetPair("atomic"); ok {
+			atomic = pair.Value.(*object.Boolean).Value
+		}
+	}
+
+	path := pathArgument(args[0])
+	content := args[1].(*object.String).Value
+
+	if dryRunFile(env, "write %d bytes to %s", len(content), path) {
+		return NULL
+	}
+
+	write := writeFile
+	if atomic {
+		write = writeFileAtomically
+	}
+
+	if writeErr := write(path, content); writeErr != nil {
+		return newIOError(tok, writeErr)
+	}
+
+	return NULL
+}
+
+// Writes the file to a temporary file in the same
+// directory, then renames it to its final path,
+// keeping the permissions of the existing file.
+func writeFileAtomically(path string, content string) error {
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.WriteString(content)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), mode)
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// append_file("app.log", "started\n")
+func appendFileFn(tok token.Token, env *object.Environment, args ...object.Object) object.Object {
+	err := validateArgs(tok, "append_file", args, 2, [][]string{{object.STRING_OBJ}, {object.STRING_OBJ}})
+	if err != nil {
+		return err
+	}
+
+	path := pathArgument(args[0])
+	content := args[1].(*object.String).Value
+
+	if dryRunFile(env, "append %d bytes to %s", len(content), path) {
+		return NULL
+	}
+
+	if appendErr := appendFile(path, content); appendErr != nil {
+		return newIOError(tok, appendErr)
+	}
+
+	return NULL
+}
+
+// exists("/etc/hosts")
+func existsFn(tok token.Token, env *object.Environment, args ...object.Object) object.Object {
+	err := validateArgs(tok, "exists", args, 1, [][]string{{object.STRING_OBJ}})
+	if err != nil {
+		return err
+	}
+
+	_, statErr := os.Stat(pathArgument(args[0]))
+	return &object.Boolean{Token: tok, Value: statErr == nil}
+}
+
+// stat("/etc/hosts")
+// Symbolic links are not followed, so that
+// we can tell whether the path is one.
+func statFn(tok token.Token, env *object.Environment, args ...object.Object) object.Object {
+	err := validateArgs(tok, "stat", args, 1, [][]string{{object.STRING_OBJ}})
+	if err != nil {
+		return err
+	}
+
+	path := pathArgument(args[0])
+	info, statErr := os.Lstat(path)
+	if statErr != nil {
+		return newIOError(tok, statErr)
+	}
+
+	return object.NewHashFromPairs(tok, []object.HashPair{
+		{Key: &object.String{Token: tok, Value: "name"}, Value: &object.String{Token: tok, Value: info.Name()}},
+		{Key: &object.String{Token: tok, Value: "path"}, Value: &object.String{Token: tok, Value: path}},
+		{Key: &object.String{Token: tok, Value: "size"}, Value: &object.Number{Token: tok, Value: float64(info.Size())}},
+		{Key: &object.String{Token: tok, Value: "mode"}, Value: &object.String{Token: tok, Value: fmt.Sprintf("%04o", info.Mode().Perm())}},
+		{Key: &object.String{Token: tok, Value: "mtime"}, Value: &object.Number{Token: tok, Value: float64(info.ModTime().UnixMilli())}},
+		{Key: &object.String{Token: tok, Value: "is_dir"}, Value: &object.Boolean{Token: tok, Value: info.IsDir()}},
+		{Key: &object.String{Token: tok, Value: "is_file"}, Value: &object.Boolean{Token: tok, Value: info.Mode().IsRegular()}},
+		{Key: &object.String{Token: tok, Value: "is_symlink"}, Value: &object.Boolean{Token: tok, Value: info.Mode()&os.ModeSymlink != 0}},
+	})
+}
+
+// list_dir("/etc")
+func listDirFn(tok token.Token, env *object.Environment, args ...object.Object) object.Object {
+	err := validateArgs(tok, "list_dir", args, 1, [][]string{{object.STRING_OBJ}})
+	if err != nil {
+		return err
+	}
+
+	entries, readErr := os.ReadDir(pathArgument(args[0]))
+	if readErr != nil {
+		return newIOError(tok, readErr)
+	}
+
+	names := []object.Object{}
+	for _, entry := range entries {
+		names = append(names, &object.String{Token: tok, Value: entry.Name()})
+	}
+
+	return &object.Array{Token: tok, Elements: names}
+}
+
+// walk("src")
+// Returns the paths of everything within the
+// directory, in lexical order, without
+// following symbolic links.
+func walkFn(tok token.Token, env *object.Environment, args ...object.Object) object.Object {
+	err := validateArgs(tok, "walk", args, 1, [][]string{{object.STRING_OBJ}})
+	if err != nil {
+		return err
+	}
+
+	root := pathArgument(args[0])
+	paths := []object.Object{}
+
+	walkErr := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if path != root {
+			paths = append(paths, &object.String{Token: tok, Value: path})
+		}
+
+		return nil
+	})
+
+	if walkErr != nil {
+		return newIOError(tok, walkErr)
+	}
+
+	return &object.Array{Token: tok, Elements: paths}
+}
+
+// mkdir("path/to/dir")
+// Just like mkdir -p, parent directories are
+// created as needed, and existing directories
+// are not an error.
+func mkdirFn(tok token.Token, env *object.Environment, args ...object.Object) object.Object {
+	err := validateArgs(tok, "mkdir", args, 1, [][]string{{object.STRING_OBJ}})
+	if err != nil {
+		return err
+	}
+
+	path := pathArgument(args[0])
+
+	if dryRunFile(env, "create directory %s", path) {
+		return NULL
+	}
+
+	if mkdirErr := os.MkdirAll(path, 0755); mkdirErr != nil {
+		return newIOError(tok, mkdirErr)
+	}
+
+	return NULL
+}
+
+// remove("path/to/dir")
+// Just like rm -rf, directories are removed along
+// with their contents, and missing paths are not
+// an error.
+func removeFn(tok token.Token, env *object.Environment, args ...object.Object) object.Object {
+	err := validateArgs(tok, "remove", args, 1, [][]string{{object.STRING_OBJ}})
+	if err != nil {
+		return err
+	}
+
+	path := pathArgument(args[0])
+
+	if dryRunFile(env, "remove %s", path) {
+		return NULL
+	}
+
+	if removeErr := os.RemoveAll(path); removeErr != nil {
+		return newIOError(tok, removeErr)
+	}
+
+	return NULL
+}
+
+// copy("src", "dst")
+func copyFn(tok token.Token, env *object.Environment, args ...object.Object) object.Object {
+	err := validateArgs(tok, "copy", args, 2, [][]string{{object.STRING_OBJ}, {object.STRING_OBJ}})
+	if err != nil {
+		return err
+	}
+
+	src, dst := pathArgument(args[0]), pathArgument(args[1])
+
+	if dryRunFile(env, "copy %s to %s", src, dst) {
+		return NULL
+	}
+
+	if copyErr := copyPath(src, dst); copyErr != nil {
+		return newIOError(tok, copyErr)
+	}
+
+	return NULL
+}
+
+// Copies a file, a symbolic link or a directory,
+// along with its contents, keeping permissions.
+func copyPath(src string, dst string) error {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+
+		return os.Symlink(target, dst)
+	case info.IsDir():
+		if err := os.MkdirAll(dst, info.Mode().Perm()); err != nil {
+			return err
+		}
+
+		entries, err := os.ReadDir(src)
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			if err := copyPath(filepath.Join(src, entry.Name()), filepath.Join(dst, entry.Name())); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// move("src", "dst")
+// Paths on different filesystems cannot simply be
+// renamed, so they are copied and then removed.
+func moveFn(tok token.Token, env *object.Environment, args ...object.Object) object.Object {
+	err := validateArgs(tok, "move", args, 2, [][]string{{object.STRING_OBJ}, {object.STRING_OBJ}})
+	if err != nil {
+		return err
+	}
+
+	src, dst := pathArgument(args[0]), pathArgument(args[1])
+
+	if dryRunFile(env, "move %s to %s", src, dst) {
+		return NULL
+	}
+
+	moveErr := os.Rename(src, dst)
+	if errors.Is(moveErr, syscall.EXDEV) {
+		moveErr = copyPath(src, dst)
+
+		if moveErr == nil {
+			moveErr = os.RemoveAll(src)
+		}
+	}
+
+	if moveErr != nil {
+		return newIOError(tok, moveErr)
+	}
+
+	return NULL
+}
+
+// chmod("deploy.sh", "755")
+func chmodFn(tok token.Token, env *object.Environment, args ...object.Object) object.Object {
+	err := validateArgs(tok, "chmod", args, 2, [][]string{{object.STRING_OBJ}, {object.STRING_OBJ}})
+	if err != nil {
+		return err
+	}
+
+	path := pathArgument(args[0])
+	mode, parseErr := strconv.ParseUint(args[1].(*object.String).Value, 8, 32)
+	if parseErr != nil || mode > 07777 {
+		return newKindError(tok, object.ARGUMENT_ERROR, "the mode passed to chmod(...) must be in octal notation, such as \"755\", got %s", args[1].Inspect())
+	}
+
+	if dryRunFile(env, "change the mode of %s to %04o", path, mode) {
+		return NULL
+	}
+
+	if chmodErr := os.Chmod(path, os.FileMode(mode)); chmodErr != nil {
+		return newIOError(tok, chmodErr)
+	}
+
+	return NULL
+}
+
+// symlink("/opt/app/releases/v2", "/opt/app/current")
+func symlinkFn(tok token.Token, env *object.Environment, args ...object.Object) object.Object {
+	err := validateArgs(tok, "symlink", args, 2, [][]string{{object.STRING_OBJ}, {object.STRING_OBJ}})
+	if err != nil {
+		return err
+	}
+
+	target, link := args[0].(*object.String).Value, pathArgument(args[1])
+
+	if dryRunFile(env, "link %s to %s", link, target) {
+		return NULL
+	}
+
+	if linkErr := os.Symlink(target, link); linkErr != nil {
+		return newIOError(tok, linkErr)
+	}
+
+	return NULL
+}
+
+// tmp_file() or tmp_file({"keep": true, "pattern": "build-*.log"})
+func tmpFileFn(tok token.Token, env *object.Environment, args ...object.Object) object.Object {
+	return tmpPath(tok, env, "tmp_file", args, func(pattern string) (string, error) {
+		f, err := os.CreateTemp("", pattern)
+		if err != nil {
+			return "", err
+		}
+
+		return f.Name(), f.Close()
+	})
+}
+
+// tmp_dir() or tmp_dir({"keep": true, "pattern": "build-*"})
+func tmpDirFn(tok token.Token, env *object.Environment, args ...object.Object) object.Object {
+	return tmpPath(tok, env, "tmp_dir", args, func(pattern string) (string, error) {
+		return os.MkdirTemp("", pattern)
+	})
+}
+
+// Creates a temporary file or directory, through create,
+// and removes it when the function that created it returns
+// or, outside of functions, when the script exits. Scripts
+// can keep it around instead, for example to look into
+// it while debugging.
+func tmpPath(tok token.Token, env *object.Environment, name string, args []object.Object, create func(pattern string) (string, error)) object.Object {
+	err, spec := validateVarArgs(tok, name, args, [][][]string{
+		{},
+		{{object.HASH_OBJ}},
+	})
+	if err != nil {
+		return err
+	}
+
+	keep := false
+	pattern := "abs-*"
+	if spec == 1 {
+		options := args[0].(*object.Hash)
+		err := validateOptions(tok, name, options, map[string][]string{
+			"keep":    {object.BOOLEAN_OBJ},
+			"pattern": {object.STRING_OBJ},
+		})
+		if err != nil {
+			return err
+		}
+
+		if pair, ok := options.GetPair("keep"); ok {
+			keep = pair.Value.(*object.Boolean).Value
+		}
+
+		if pair, ok := options.GetPair("pattern"); ok {
+			pattern = pair.Value.(*object.String).Value
+		}
+	}
+
+	path, createErr := create(pattern)
+	if createErr != nil {
+		return newIOError(tok, createErr)
+	}
+
+	if !keep {
+		env.Defer(func() {
+			os.RemoveAll(path)
+		})
+	}
+
+	return &object.String{Token: tok, Value: path}
+}
+
+// signalPump handles signals on behalf of builtins
+// that keep the script busy without running any
+// statement, such as watch(...) or http.serve(...).
+// Handlers set through on_signal(...) only run in
+// between statements, so the signals received
+// meanwhile are handled whenever C ticks, through
+// pump().
+type signalPump struct {
+	C      <-chan time.Time
+	ticker *time.Ticker
+	env    *object.Environment
+}
+
+func newSignalPump(env *object.Environment, interval time.Duration) *signalPump {
+	ticker := time.NewTicker(interval)
+	return &signalPump{C: ticker.C, ticker: ticker, env: env}
+}
+
+// Runs the handlers of the signals received
+// since the last tick, returning the error
+// raised by any of them
+func (p *signalPump) pump() object.Object {
+	return handleSignals(p.env)
+}
+
+func (p *signalPump) stop() {
+	p.ticker.Stop()
+}
+
+// watch("src", f(event) { ... }, {"recursive": true, "debounce": 100, "interval": 250})
+// Runs the function whenever the files change, until
+// it returns false. Files are checked periodically
+// (every interval) and, with a debounce, changes are
+// only reported once files have stopped changing for
+// that long, so that a burst of changes triggers the
+// function once per file.
+func watchFn(tok token.Token, env *object.Environment, args ...object.Object) object.Object {
+	err, spec := validateVarArgs(tok, "watch", args, [][][]string{
+		{{object.STRING_OBJ, object.ARRAY_OBJ}, {object.FUNCTION_OBJ}},
+		{{object.STRING_OBJ, object.ARRAY_OBJ}, {object.FUNCTION_OBJ}, {object.HASH_OBJ}},
+	})
+	if err != nil {
+		return err
+	}
+
+	paths := []string{}
+	switch arg := args[0].(type) {
+	case *object.String:
+		paths = append(paths, pathArgument(arg))
+	case *object.Array:
+		for _, e := range arg.Elements {
+			if e.Type() != object.STRING_OBJ {
+				return newKindError(tok, object.ARGUMENT_ERROR, "the paths passed to watch(...) must be strings, got %s", arg.Inspect())
+			}
+
+			paths = append(paths, pathArgument(e))
+		}
+	}
+
+	recursive := false
+	debounce := time.Duration(0)
+	interval := 250 * time.Millisecond
+
+	if spec == 1 {
+		options := args[2].(*object.Hash)
+		err := validateOptions(tok, "watch", options, map[string][]string{
+			"recursive": {object.BOOLEAN_OBJ},
+			"debounce":  {object.NUMBER_OBJ},
+			"interval":  {object.NUMBER_OBJ},
+		})
+		if err != nil {
+			return err
+		}
+
+		if pair, ok := options.GetPair("recursive"); ok {
+			recursive = pair.Value.(*object.Boolean).Value
+		}
+
+		if pair, ok := options.GetPair("debounce"); ok {
+			ms := pair.Value.(*object.Number).Value
+			if ms < 0 {
+				return newKindError(tok, object.ARGUMENT_ERROR, "the debounce option to watch(...) cannot be negative, got %s", pair.Value.Inspect())
+			}
+
+			debounce = time.Duration(ms * float64(time.Millisecond))
+		}
+
+		if pair, ok := options.GetPair("interval"); ok {
+			ms := pair.Value.(*object.Number).Value
+			if ms <= 0 {
+				return newKindError(tok, object.ARGUMENT_ERROR, "the interval option to watch(...) must be a positive number of milliseconds, got %s", pair.Value.Inspect())
+			}
+
+			interval = time.Duration(ms * float64(time.Millisecond))
+		}
+	}
+
+	watcher := util.NewWatcher(paths, recursive)
+	// Changes waiting for files to settle, by path
+	pending := map[string]util.WatchEvent{}
+	order := []string{}
+	lastChange := time.Time{}
+
+	signals := newSignalPump(env, interval)
+	defer signals.stop()
+
+	for {
+		<-signals.C
+
+		if err := signals.pump(); err != nil {
+			return err
+		}
+
+		for _, event := range watcher.Poll() {
+			// A file that's created and then written to
+			// is still a new file
+			if p, ok := pending[event.Path]; ok && p.Op == "create" && event.Op == "write" {
+				continue
+			}
+
+			if _, ok := pending[event.Path]; !ok {
+				order = append(order, event.Path)
+			}
+
+			pending[event.Path] = event
+			lastChange = event.Time
+		}
+
+		if len(pending) == 0 || time.Since(lastChange) < debounce {
+			continue
+		}
+
+		for _, path := range order {
+			res := applyFunction(tok, args[1], env, []object.Object{watchEventToHash(tok, pending[path])})
+			if isError(res) {
+				return res
+			}
+
+			// Returning false stops watching
+			if b, ok := res.(*object.Boolean); ok && !b.Value {
+				return NULL
+			}
+		}
+
+		pending = map[string]util.WatchEvent{}
+		order = []string{}
+	}
+}
+
+func watchEventToHash(tok token.Token, event util.WatchEvent) *object.Hash {
+	return object.NewHashFromPairs(tok, []object.HashPair{
+		{Key: &object.String{Token: tok, Value: "path"}, Value: &object.String{Token: tok, Value: event.Path}},
+		{Key: &object.String{Token: tok, Value: "op"}, Value: &object.String{Token: tok, Value: event.Op}},
+		{Key: &object.String{Token: tok, Value: "time"}, Value: &object.Number{Token: tok, Value: float64(event.Time.UnixMilli())}},
+	})
+}
+
+// Resolves a path against the directory of the
+// script, just like require(...) does, so that
+// scripts behave the same wherever they are
+// run from
+func scriptPath(env *object.Environment, arg object.Object) string {
+	path := pathArgument(arg)
+
+	if filepath.IsAbs(path) {
+		return path
+	}
+
+	return filepath.Join(env.Dir, path)
+}
+
+// glob("src/**/*.go")
+// Relative patterns are resolved against the
+// directory of the script, and their matches
+// are relative to it as well.
+func globFn(tok token.Token, env *object.Environment, args ...object.Object) object.Object {
+	err := validateArgs(tok, "glob", args, 1, [][]string{{object.STRING_OBJ}})
+	if err != nil {
+		return err
+	}
+
+	paths, globErr := util.Glob(scriptPath(env, args[0]))
+	if globErr != nil {
+		return newKindError(tok, object.ARGUMENT_ERROR, "invalid pattern %s: %s", args[0].Inspect(), globErr.Error())
+	}
+
+	pattern := pathArgument(args[0])
+
+	matches := []object.Object{}
+	for _, path := range paths {
+		if rel, relErr := filepath.Rel(env.Dir, path); relErr == nil && !filepath.IsAbs(pattern) {
+			path = rel
+		}
+
+		matches = append(matches, &object.String{Token: tok, Value: path})
+	}
+
+	return &object.Array{Token: tok, Elements: matches}
+}
+
+// path.join("a", "b", "c.txt")
+func pathJoinFn(tok token.Token, env *object.Environment, args ...object.Object) object.Object {
+	parts := []string{}
+
+	for _, arg := range args {
+		if arg.Type() != object.STRING_OBJ {
+			return newKindError(tok, object.ARGUMENT_ERROR, "Wrong arguments passed to 'path.join'. Usage:\npath.join(STRING, ...)")
+		}
+
+		parts = append(parts, arg.(*object.String).Value)
+	}
+
+	return &object.String{Token: tok, Value: filepath.Join(parts...)}
+}
+
+// Runs a function transforming a
+// single path, such as path.base(...)
+func pathFn(tok token.Token, name string, args []object.Object, fn func(string) string) object.Object {
+	err := validateArgs(tok, name, args, 1, [][]string{{object.STRING_OBJ}})
+	if err != nil {
+		return err
+	}
+
+	return &object.String{Token: tok, Value: fn(args[0].(*object.String).Value)}
+}
+
+// path.base("/a/b.txt")
+func pathBaseFn(tok token.Token, env *object.Environment, args ...object.Object) object.Object {
+	return pathFn(tok, "path.base", args, filepath.Base)
+}
+
+// path.dir("/a/b.txt")
+func pathDirFn(tok token.Token, env *object.Environment, args ...object.Object) object.Object {
+	return pathFn(tok, "path.dir", args, filepath.Dir)
+}
+
+// path.ext("/a/b.txt")
+func pathExtFn(tok token.Token, env *object.Environment, args ...object.Object) object.Object {
+	return pathFn(tok, "path.ext", args, filepath.Ext)
+}
+
+// path.clean("a/../b/./c.txt")
+func pathCleanFn(tok token.Token, env *object.Environment, args ...object.Object) object.Object {
+	return pathFn(tok, "path.clean", args, filepath.Clean)
+}
+
+// path.abs("b.txt")
+// Relative paths are resolved against
+// the directory of the script.
+func pathAbsFn(tok token.Token, env *object.Environment, args ...object.Object) object.Object {
+	err := validateArgs(tok, "path.abs", args, 1, [][]string{{object.STRING_OBJ}})
+	if err != nil {
+		return err
+	}
+
+	path, absErr := filepath.Abs(scriptPath(env, args[0]))
+	if absErr != nil {
+		return newIOError(tok, absErr)
+	}
+
+	return &object.String{Token: tok, Value: path}
+}
+
+// path.rel("/a/b.txt") or path.rel("/a/b.txt", "/a")
+// Returns the path relative to the base, by default the
+// directory of the script, such as ../b.txt.
+func pathRelFn(tok token.Token, env *object.Environment, args ...object.Object) object.Object {
+	err, spec := validateVarArgs(tok, "path.rel", args, [][][]string{
+		{{object.STRING_OBJ}},
+		{{object.STRING_OBJ}, {object.STRING_OBJ}},
+	})
+	if err != nil {
+		return err
+	}
+
+	base := env.Dir
+	if spec == 1 {
+		base = scriptPath(env, args[1])
+	}
+
+	target, absErr := filepath.Abs(scriptPath(env, args[0]))
+	if absErr == nil {
+		base, absErr = filepath.Abs(base)
+	}
+	if absErr != nil {
+		return newIOError(tok, absErr)
+	}
+
+	path, relErr := filepath.Rel(base, target)
+	if relErr != nil {
+		return newKindError(tok, object.ARGUMENT_ERROR, "%s", relErr.Error())
+	}
+
+	return &object.String{Token: tok, Value: path}
+}
+
+// http.get(url), http.post(url, options) etc
+func httpMethodFn(method string) func(tok token.Token, env *object.Environment, args ...object.Object) object.Object {
+	name := "http." + strings.ToLower(method)
+
+	return func(tok token.Token, env *object.Environment, args ...object.Object) object.Object {
+		err, spec := validateVarArgs(tok, name, args, [][][]string{
+			{{object.STRING_OBJ}},
+			{{object.STRING_OBJ}, {object.HASH_OBJ}},
+		})
+		if err != nil {
+			return err
+		}
+
+		options := &object.Hash{}
+		if spec == 1 {
+			options = args[1].(*object.Hash)
+		}
+
+		return httpRequest(tok, env, name, method, args[0].(*object.String).Value, options)
+	}
+}
+
+// http.request("PATCH", url) or http.request("PATCH", url, options)
+func httpRequestFn(tok token.Token, env *object.Environment, args ...object.Object) object.Object {
+	err, spec := validateVarArgs(tok, "http.request", args, [][][]string{
+		{{object.STRING_OBJ}, {object.STRING_OBJ}},
+		{{object.STRING_OBJ}, {object.STRING_OBJ}, {object.HASH_OBJ}},
+	})
+	if err != nil {
+		return err
+	}
+
+	options := &object.Hash{}
+	if spec == 1 {
+		options = args[2].(*object.Hash)
+	}
+
+	method := strings.ToUpper(args[0].(*object.String).Value)
+	return httpRequest(tok, env, "http.request", method, args[1].(*object.String).Value, options)
+}
+
+// Sends an HTTP request, returning the response as
+// {status, url, headers, body, json()}. Responses with
+// an error status, such as 404, are returned like any
+// other, whereas requests that can't be completed,
+// such as when the server can't be reached, raise
+// an HTTPError.
+//
+// Options:
+//
+// * headers: the headers of the request
+// * query: parameters to add to the url
+// * body: the body of the request
+// * json: a value to send as JSON
+// * timeout: how long, in ms, the request can take (30s by default)
+// * redirects: how many redirects to follow (10 by default)
+// * basic_auth: a [user, password] pair
+// * bearer: a token to send in the Authorization header
+// * ca: the path of the certificates to verify the server against
+// * insecure: whether to skip verifying the server's certificate
+// * safe: whether to send the request in dry-run mode
+func httpRequest(tok token.Token, env *object.Environment, name string, method string, rawURL string, options *object.Hash) object.Object {
+	err := validateOptions(tok, name, options, map[string][]string{
+		"headers":    {object.HASH_OBJ},
+		"query":      {object.HASH_OBJ},
+		"body":       {object.STRING_OBJ},
+		"json":       {object.STRING_OBJ, object.NUMBER_OBJ, object.BOOLEAN_OBJ, object.NULL_OBJ, object.ARRAY_OBJ, object.HASH_OBJ},
+		"timeout":    {object.NUMBER_OBJ},
+		"redirects":  {object.NUMBER_OBJ},
+		"basic_auth": {object.ARRAY_OBJ},
+		"bearer":     {object.STRING_OBJ},
+		"ca":         {object.STRING_OBJ},
+		"insecure":   {object.BOOLEAN_OBJ},
+		"safe":       {object.BOOLEAN_OBJ},
+	})
+	if err != nil {
+		return err
+	}
+
+	u, urlErr := url.Parse(rawURL)
+	if urlErr != nil || u.Scheme == "" || u.Host == "" {
+		return newKindError(tok, object.ARGUMENT_ERROR, "invalid url passed to %s(...): %s", name, rawURL)
+	}
+
+	if pair, ok := options.GetPair("query"); ok {
+		query := u.Query()
+		for _, v := range pair.Value.(*object.Hash).OrderedPairs() {
+			query.Add(v.Key.Inspect(), v.Value.Inspect())
+		}
+
+		u.RawQuery = query.Encode()
+	}
+
+	var body io.Reader
+	contentType := ""
+	_, hasBody := options.GetPair("body")
+	_, hasJSON := options.GetPair("json")
+
+	switch {
+	case hasBody && hasJSON:
+		return newKindError(tok, object.ARGUMENT_ERROR, "the body and json options to %s(...) cannot be used together", name)
+	case hasBody:
+		pair, _ := options.GetPair("body")
+		body = strings.NewReader(pair.Value.Inspect())
+	case hasJSON:
+		pair, _ := options.GetPair("json")
+		body = strings.NewReader(object.EncodeJson(pair.Value, "", false))
+		contentType = "application/json"
+	}
+
+	req, reqErr := http.NewRequest(method, u.String(), body)
+	if reqErr != nil {
+		return newKindError(tok, object.ARGUMENT_ERROR, "invalid request passed to %s(...): %s", name, reqErr.Error())
+	}
+
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	if pair, ok := options.GetPair("bearer"); ok {
+		req.Header.Set("Authorization", "Bearer "+pair.Value.Inspect())
+	}
+
+	if pair, ok := options.GetPair("basic_auth"); ok {
+		credentials := pair.Value.(*object.Array).Elements
+		if len(credentials) != 2 || credentials[0].Type() != object.STRING_OBJ || credentials[1].Type() != object.STRING_OBJ {
+			return newKindError(tok, object.ARGUMENT_ERROR, "the basic_auth option to %s(...) must be a [user, password] pair, got %s", name, pair.Value.Inspect())
+		}
+
+		req.SetBasicAuth(credentials[0].Inspect(), credentials[1].Inspect())
+	}
+
+	// Headers are set last, so that
+	// they can override any of the
+	// above, such as Content-Type
+	if pair, ok := options.GetPair("headers"); ok {
+		for _, v := range pair.Value.(*object.Hash).OrderedPairs() {
+			req.Header.Set(v.Key.Inspect(), v.Value.Inspect())
+		}
+	}
+
+	client, err := httpClient(tok, name, options)
+	if err != nil {
+		return err
+	}
+
+	traceCall(env, tok, "%s %s", method, u.String())
+
+	// Requests that only read are sent anyway
+	// in dry-run mode, just like safe commands
+	safe := method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+	if pair, ok := options.GetPair("safe"); ok {
+		safe = pair.Value.(*object.Boolean).Value
+	}
+
+	if env.Settings.DryRun && !safe {
+		fmt.Fprintf(env.Stdio.Stderr, "[dry-run] %s %s\n", method, u.String())
+		return httpResponseToHash(tok, http.StatusOK, u.String(), http.Header{}, "")
+	}
+
+	resume := yield()
+	res, resErr := client.Do(req)
+	var content []byte
+	var readErr error
+	if resErr == nil {
+		content, readErr = io.ReadAll(res.Body)
+		res.Body.Close()
+	}
+	resume()
+
+	if resErr != nil {
+		return newKindError(tok, object.HTTP_ERROR, "%s", resErr.Error())
+	}
+
+	if readErr != nil {
+		return newKindError(tok, object.HTTP_ERROR, "%s", readErr.Error())
+	}
+
+	return httpResponseToHash(tok, res.StatusCode, res.Request.URL.String(), res.Header, string(content))
+}
+
+// Creates the client sending a request, applying the
+// options that control how the request is sent rather
+// than what's sent, such as timeouts and redirects
+func httpClient(tok token.Token, name string, options *object.Hash) (*http.Client, object.Object) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{}
+	client.Transport = transport
+
+	if pair, ok := options.GetPair("timeout"); ok {
+		timeout := pair.Value.(*object.Number).Value
+		if timeout <= 0 {
+			return nil, newKindError(tok, object.ARGUMENT_ERROR, "the timeout option to %s(...) must be a positive number of milliseconds, got %s", name, pair.Value.Inspect())
+		}
+
+		client.Timeout = time.Duration(timeout * float64(time.Millisecond))
+	}
+
+	if pair, ok := options.GetPair("redirects"); ok {
+		redirects := pair.Value.(*object.Number)
+		if redirects.Value < 0 || !redirects.IsInt() {
+			return nil, newKindError(tok, object.ARGUMENT_ERROR, "the redirects option to %s(...) must be a positive integer, got %s", name, redirects.Inspect())
+		}
+
+		// Once we've followed enough redirects, the
+		// last response is returned as it is
+		client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			if len(via) > redirects.Int() {
+				return http.ErrUseLastResponse
+			}
+
+			return nil
+		}
+	}
+
+	if pair, ok := options.GetPair("ca"); ok {
+		pem, readErr := os.ReadFile(pathArgument(pair.Value))
+		if readErr != nil {
+			return nil, newIOError(tok, readErr)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, newKindError(tok, object.ARGUMENT_ERROR, "the ca option to %s(...) must point to PEM encoded certificates, got %s", name, pair.Value.Inspect())
+		}
+
+		transport.TLSClientConfig.RootCAs = pool
+	}
+
+	if pair, ok := options.GetPair("insecure"); ok {
+		transport.TLSClientConfig.InsecureSkipVerify = pair.Value.(*object.Boolean).Value
+	}
+
+	return client, nil
+}
+
+// Converts an HTTP response into an hash, such as
+// {"status": 200, "headers": {"content-type": "application/json"}, "body": "{}"}
+func httpResponseToHash(tok token.Token, status int, location string, header http.Header, body string) *object.Hash {
+	return object.NewHashFromPairs(tok, []object.HashPair{
+		{Key: &object.String{Token: tok, Value: "status"}, Value: &object.Number{Token: tok, Value: float64(status)}},
+		{Key: &object.String{Token: tok, Value: "url"}, Value: &object.String{Token: tok, Value: location}},
+		{Key: &object.String{Token: tok, Value: "headers"}, Value: httpHeadersToHash(tok, header)},
+		{Key: &object.String{Token: tok, Value: "body"}, Value: &object.String{Token: tok, Value: body}},
+		{Key: &object.String{Token: tok, Value: "json"}, Value: httpBodyJSON(body)},
+	})
+}
+
+// Converts HTTP headers into an hash, such as
+// {"content-type": "application/json"}. Names are
+// lowercase, and values are joined with commas
+// when they appear more than once.
+func httpHeadersToHash(tok token.Token, header http.Header) *object.Hash {
+	names := []string{}
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := []object.HashPair{}
+	for _, name := range names {
+		pairs = append(pairs, object.HashPair{Key: &object.String{Token: tok, Value: strings.ToLower(name)}, Value: &object.String{Token: tok, Value: strings.Join(header[name], ", ")}})
+	}
+
+	return object.NewHashFromPairs(tok, pairs)
+}
+
+// Returns the json() function of requests and
+// responses, which decodes their body as JSON
+func httpBodyJSON(body string) *object.Builtin {
+	return &object.Builtin{
+		Fn: func(tok token.Token, env *object.Environment, args ...object.Object) object.Object {
+			return jsonFn(tok, env, &object.String{Token: tok, Value: body})
+		},
+		Doc: "decodes the body as JSON",
+	}
+}
+
+// A request received by http.serve(...), along
+// with the function handling it
+type serveRequest struct {
+	handler object.Object
+	pattern string
+	r       *http.Request
+	body    string
+}
+
+type serveResponse struct {
+	status int
+	header http.Header
+	body   string
+}
+
+// http.serve(":8080", f(req) { ... })
+// or http.serve(":8080", {"GET /users/{id}": f(req) { ... }})
+//
+// Each request is handled in its own goroutine, but
+// handlers take turns at evaluating code, just like the
+// functions of parallel(...): they run concurrently
+// only while they wait on commands, requests or
+// sleep(...). The server stops gracefully when the
+// script receives INT or TERM, letting the requests
+// being served complete, and when a handler calls
+// exit(...).
+func httpServeFn(tok token.Token, env *object.Environment, args ...object.Object) object.Object {
+	err := validateArgs(tok, "http.serve", args, 2, [][]string{{object.STRING_OBJ}, {object.FUNCTION_OBJ, object.HASH_OBJ}})
+	if err != nil {
+		return err
+	}
+
+	// Once done is closed, the script has moved
+	// on and requests still waiting for their
+	// turn get a 503
+	from := position{lex, lexFile, callStack}
+	exits := make(chan object.Object, 1)
+	done := make(chan struct{})
+	defer close(done)
+
+	handle := func(req *serveRequest) (res serveResponse, ok bool) {
+		takeTurn(from, func() {
+			select {
+			case <-done:
+				return
+			default:
+			}
+
+			var err object.Object
+			res, err = serveHandle(tok, env, req)
+			ok = true
+
+			if _, exit := err.(*object.ExitError); exit {
+				select {
+				case exits <- err:
+				default:
+				}
+			}
+		})
+
+		return res, ok
+	}
+
+	mux, err := serveMux(tok, args[1], handle)
+	if err != nil {
+		return err
+	}
+
+	listener, listenErr := net.Listen("tcp", args[0].(*object.String).Value)
+	if listenErr != nil {
+		return newKindError(tok, object.HTTP_ERROR, "%s", listenErr.Error())
+	}
+
+	server := &http.Server{Handler: mux}
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(listener)
+	}()
+
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupts)
+
+	// While shutting down we keep handling requests,
+	// as the server waits for the ones it received
+	// to complete
+	var result object.Object = NULL
+	stopped := make(chan struct{})
+	stopping := false
+	stop := func(res object.Object) {
+		if stopping {
+			return
+		}
+
+		stopping = true
+		result = res
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			server.Shutdown(ctx)
+			close(stopped)
+		}()
+	}
+
+	signals := newSignalPump(env, 50*time.Millisecond)
+	defer signals.stop()
+
+	for {
+		// Handlers run while we wait
+		resume := yield()
+
+		select {
+		case exit := <-exits:
+			resume()
+			stop(exit)
+		case <-interrupts:
+			resume()
+			stop(NULL)
+		case <-signals.C:
+			resume()
+			if err := signals.pump(); err != nil {
+				stop(err)
+			}
+		case serveErr := <-served:
+			resume()
+			if serveErr != http.ErrServerClosed {
+				return newKindError(tok, object.HTTP_ERROR, "%s", serveErr.Error())
+			}
+		case <-stopped:
+			resume()
+			return result
+		}
+	}
+}
+
+// Routes requests to their handler, which is either
+// a single function or an hash of functions by pattern,
+// such as {"GET /users/{id}": f(req) { ... }}
+// Requests are passed to handle, which tells us
+// whether the script is still serving them: if
+// not, the client gets a 503.
+func serveMux(tok token.Token, handlers object.Object, handle func(*serveRequest) (serveResponse, bool)) (mux *http.ServeMux, err object.Object) {
+	mux = http.NewServeMux()
+	routes := map[string]object.Object{"/": handlers}
+
+	if hash, ok := handlers.(*object.Hash); ok {
+		routes = map[string]object.Object{}
+
+		for _, pair := range hash.OrderedPairs() {
+			if pair.Value.Type() != object.FUNCTION_OBJ {
+				return nil, newKindError(tok, object.ARGUMENT_ERROR, "the route '%s' passed to http.serve(...) must be a function, got %s", pair.Key.Inspect(), pair.Value.Type())
+			}
+
+			routes[pair.Key.Inspect()] = pair.Value
+		}
+	}
+
+	// The mux panics on invalid or
+	// conflicting patterns
+	defer func() {
+		if r := recover(); r != nil {
+			mux, err = nil, newKindError(tok, object.ARGUMENT_ERROR, "invalid route passed to http.serve(...): %v", r)
+		}
+	}()
+
+	for pattern, handler := range routes {
+		mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			res, ok := handle(&serveRequest{handler: handler, pattern: pattern, r: r, body: string(body)})
+			if !ok {
+				http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+				return
+			}
+
+			for name, values := range res.header {
+				w.Header()[name] = values
+			}
+			w.WriteHeader(res.status)
+			io.WriteString(w, res.body)
+		})
+	}
+
+	return mux, nil
+}
+
+// Runs the function handling a request, converting
+// what it returns into the response: either an hash
+// such as {"status": 201, "headers": {...}, "body": "..."}
+// or a string, sent as the body. Errors raised by
+// the function are printed, and the client gets a
+// 500 instead.
+func serveHandle(tok token.Token, env *object.Environment, req *serveRequest) (serveResponse, object.Object) {
+	result := applyFunction(tok, req.handler, env, []object.Object{serveRequestToHash(tok, req)})
+	res, err := serveResult(tok, result)
+
+	if err != nil {
+		if _, ok := err.(*object.ExitError); !ok {
+			fmt.Fprintln(env.Stdio.Stderr, err.Inspect())
+		}
+
+		return serveResponse{status: http.StatusInternalServerError, header: http.Header{}, body: http.StatusText(http.StatusInternalServerError)}, err
+	}
+
+	return res, nil
+}
+
+// Converts what a handler returned into a response
+func serveResult(tok token.Token, result object.Object) (serveResponse, object.Object) {
+	res := serveResponse{status: http.StatusOK, header: http.Header{}}
+
+	switch result := result.(type) {
+	case *object.Error, *object.ExitError:
+		return res, result
+	case *object.String:
+		res.body = result.Value
+		return res, nil
+	case *object.Hash:
+		err := validateOptions(tok, "http.serve", result, map[string][]string{
+			"status":  {object.NUMBER_OBJ},
+			"headers": {object.HASH_OBJ},
+			"body":    {object.STRING_OBJ},
+			"json":    {object.STRING_OBJ, object.NUMBER_OBJ, object.BOOLEAN_OBJ, object.NULL_OBJ, object.ARRAY_OBJ, object.HASH_OBJ},
+		})
+		if err != nil {
+			return res, err
+		}
+
+		if pair, ok := result.GetPair("status"); ok {
+			status := pair.Value.(*object.Number)
+			if !status.IsInt() || status.Value < 100 || status.Value > 999 {
+				return res, newKindError(tok, object.ARGUMENT_ERROR, "invalid status returned to http.serve(...): %s", status.Inspect())
+			}
+
+			res.status = status.Int()
+		}
+
+		if pair, ok := result.GetPair("json"); ok {
+			res.header.Set("Content-Type", "application/json")
+			res.body = object.EncodeJson(pair.Value, "", false)
+		}
+
+		if pair, ok := result.GetPair("body"); ok {
+			res.body = pair.Value.Inspect()
+		}
+
+		if pair, ok := result.GetPair("headers"); ok {
+			for _, v := range pair.Value.(*object.Hash).OrderedPairs() {
+				res.header.Set(v.Key.Inspect(), v.Value.Inspect())
+			}
+		}
+
+		return res, nil
+	}
+
+	return res, newKindError(tok, object.TYPE_ERROR, "the functions passed to http.serve(...) must return an hash or a string, got %s", result.Type())
+}
+
+// Converts a request received by http.serve(...)
+// into the hash passed to its handler
+func serveRequestToHash(tok token.Token, req *serveRequest) *object.Hash {
+	values := req.r.URL.Query()
+	names := []string{}
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// Parameters passed more than once,
+	// such as ?a=1&a=2, keep the first value
+	query := []object.HashPair{}
+	for _, name := range names {
+		query = append(query, object.HashPair{Key: &object.String{Token: tok, Value: name}, Value: &object.String{Token: tok, Value: values.Get(name)}})
+	}
+
+	// Wildcards in the route, such as
+	// {id} in /users/{id}
+	params := []object.HashPair{}
+	for _, segment := range strings.Split(req.pattern, "/") {
+		if !strings.HasPrefix(segment, "{") || !strings.HasSuffix(segment, "}") || segment == "{$}" {
+			continue
+		}
+
+		name := strings.TrimSuffix(strings.Trim(segment, "{}"), "...")
+		params = append(params, object.HashPair{Key: &object.String{Token: tok, Value: name}, Value: &object.String{Token: tok, Value: req.r.PathValue(name)}})
+	}
+
+	return object.NewHashFromPairs(tok, []object.HashPair{
+		{Key: &object.String{Token: tok, Value: "method"}, Value: &object.String{Token: tok, Value: req.r.Method}},
+		{Key: &object.String{Token: tok, Value: "path"}, Value: &object.String{Token: tok, Value: req.r.URL.Path}},
+		{Key: &object.String{Token: tok, Value: "query"}, Value: object.NewHashFromPairs(tok, query)},
+		{Key: &object.String{Token: tok, Value: "params"}, Value: object.NewHashFromPairs(tok, params)},
+		{Key: &object.String{Token: tok, Value: "headers"}, Value: httpHeadersToHash(tok, req.r.Header)},
+		{Key: &object.String{Token: tok, Value: "body"}, Value: &object.String{Token: tok, Value: req.body}},
+		{Key: &object.String{Token: tok, Value: "json"}, Value: httpBodyJSON(req.body)},
+		{Key: &object.String{Token: tok, Value: "remote_addr"}, Value: &object.String{Token: tok, Value: req.r.RemoteAddr}},
+	})
+}
@@ -89,6 +89,10 @@ func (l *Lexer) NextToken() token.Token {
 			l.readChar()
 			literal := string(ch) + string(l.ch)
 			tok.Literal = literal
+		} else if l.peekChar() == '>' {
+			tok = l.newToken(token.ARROW)
+			l.readChar()
+			tok.Literal = "=>"
 		} else {
 			tok = l.newToken(token.ASSIGN)
 		}
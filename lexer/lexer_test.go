@@ -120,6 +120,8 @@ f hello(x, y) {
 !in_variable_named_in
 !i
 defer fn
+match x { _ => 1 }
+a == b => c
 `
 
 	tests := []struct {
@@ -417,6 +419,18 @@ defer fn
 		{token.IDENT, "i"},
 		{token.DEFER, "defer"},
 		{token.IDENT, "fn"},
+		{token.MATCH, "match"},
+		{token.IDENT, "x"},
+		{token.LBRACE, "{"},
+		{token.IDENT, "_"},
+		{token.ARROW, "=>"},
+		{token.NUMBER, "1"},
+		{token.RBRACE, "}"},
+		{token.IDENT, "a"},
+		{token.EQ, "=="},
+		{token.IDENT, "b"},
+		{token.ARROW, "=>"},
+		{token.IDENT, "c"},
 		{token.EOF, ""},
 	}
 
@@ -19,6 +19,9 @@ func NewEnclosedEnvironment(outer *Environment, args []Object) *Environment {
 	)
 	env.outer = outer
 	env.CurrentArgs = args
+	env.Jobs = outer.Jobs
+	env.Settings = outer.Settings
+	env.Traps = outer.Traps
 	return env
 }
 
@@ -38,6 +41,9 @@ func NewEnvironment(stdio *Stdio, dir string, version string, interactive bool)
 		Dir:         dir,
 		Version:     version,
 		Interactive: interactive,
+		Jobs:        NewJobs(),
+		Traps:       NewTraps(),
+		Settings:    &Settings{},
 	}
 	e.Set("ABS_VERSION", &String{Value: e.Version})
 
@@ -48,6 +54,7 @@ func NewEnvironment(stdio *Stdio, dir string, version string, interactive bool)
 	}
 
 	e.Set("ABS_INTERACTIVE", i)
+	e.Set("ABS_DRY_RUN", FALSE)
 
 	return e
 }
@@ -81,10 +88,72 @@ type Environment struct {
 	// wihout having to specify its full absolute path
 	// eg. require("/tmp/B")
 	Dir string
+	// File represents the script we're executing code from,
+	// and is empty when running code through the REPL
+	File string
 	// Version of the ABS runtime
 	Version string
 	// is abs running in interactive mode?
 	Interactive bool
+	// Commands running in background, shared
+	// by all environments of a script
+	Jobs *Jobs
+	// How the script should be run, shared
+	// by all environments of a script
+	Settings *Settings
+	// Functions to run when the script receives
+	// a signal or exits, shared by all
+	// environments of a script
+	Traps *Traps
+	// Functions to run when the function this
+	// environment belongs to returns
+	deferred []func()
+}
+
+// Settings change the way scripts are run:
+// they're typically set through flags passed
+// to the interpreter, such as abs --strict
+type Settings struct {
+	// In strict mode failing commands and
+	// missing hash keys raise errors
+	Strict bool
+	// Where to trace the statements being
+	// run, if anywhere (abs --trace)
+	Trace io.Writer
+	// In dry-run mode commands and file writes
+	// are printed rather than carried out
+	DryRun bool
+}
+
+// SetSettings changes how the script is run,
+// letting it know whether it's in dry-run mode
+// through ABS_DRY_RUN
+func (e *Environment) SetSettings(settings *Settings) {
+	e.Settings = settings
+	e.Set("ABS_DRY_RUN", &Boolean{Value: settings.DryRun})
+}
+
+// Defer registers a function to be run when the
+// function this environment belongs to returns, just
+// like defer does with ABS code. Outside of functions,
+// it runs when the script exits instead.
+func (e *Environment) Defer(fn func()) {
+	if e.outer == nil {
+		e.Traps.AtExit(&Trap{Fn: fn})
+		return
+	}
+
+	e.deferred = append(e.deferred, fn)
+}
+
+// RunDeferred runs the functions registered through
+// Defer, most recently registered first
+func (e *Environment) RunDeferred() {
+	for i := len(e.deferred) - 1; i >= 0; i-- {
+		e.deferred[i]()
+	}
+
+	e.deferred = nil
 }
 
 // Get returns an identifier stored within the environment
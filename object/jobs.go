@@ -0,0 +1,176 @@
+package object
+
+import (
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Job is a command running in background,
+// such as `sleep 10 &`, or being streamed,
+// such as stream(`tail -f app.log`)
+type Job struct {
+	Command string
+	Cmd     *String
+}
+
+// State returns the state of the job:
+// running, done, failed (the command exited
+// with an error) or killed (by a signal).
+func (j *Job) State() string {
+	select {
+	case <-j.Cmd.Finished():
+	default:
+		return "running"
+	}
+
+	switch {
+	case j.Cmd.TimedOut || j.Cmd.ExitCode == -1:
+		return "killed"
+	case j.Cmd.Ok == TRUE:
+		return "done"
+	default:
+		return "failed"
+	}
+}
+
+// over returns a channel that is closed once
+// the job is over. A streamed command is only
+// over once its output has been read, so the
+// rest of it is discarded.
+func (j *Job) over() <-chan struct{} {
+	over := make(chan struct{})
+
+	go func() {
+		j.Cmd.Wait()
+		close(over)
+	}()
+
+	return over
+}
+
+// Jobs is the table of commands started
+// in background by a script, in the order
+// they were started.
+type Jobs struct {
+	jobs []*Job
+	mux  sync.Mutex
+}
+
+// NewJobs creates an empty job table
+func NewJobs() *Jobs {
+	return &Jobs{}
+}
+
+// Add records a command started in background
+// or streamed
+func (j *Jobs) Add(command string, cmd *String) {
+	j.mux.Lock()
+	defer j.mux.Unlock()
+
+	j.jobs = append(j.jobs, &Job{Command: command, Cmd: cmd})
+}
+
+// List returns all jobs, in the
+// order they were started
+func (j *Jobs) List() []*Job {
+	j.mux.Lock()
+	defer j.mux.Unlock()
+
+	return append([]*Job{}, j.jobs...)
+}
+
+// Running returns the jobs that
+// are still running
+func (j *Jobs) Running() []*Job {
+	running := []*Job{}
+
+	for _, job := range j.List() {
+		if job.State() == "running" {
+			running = append(running, job)
+		}
+	}
+
+	return running
+}
+
+// Cleanup terminates the jobs that are still
+// running, so that they don't outlive the script
+// that started them: they are first asked to
+// terminate and, if they don't within the grace
+// period, they are killed.
+func (j *Jobs) Cleanup(grace time.Duration) {
+	running := j.Running()
+
+	for _, job := range running {
+		if sig, ok := ParseSignal("TERM"); ok {
+			job.Cmd.Signal(sig)
+		}
+	}
+
+	deadline := time.After(grace)
+	expired := false
+
+	for _, job := range running {
+		if !expired {
+			select {
+			case <-job.over():
+				continue
+			case <-deadline:
+				expired = true
+			}
+		}
+
+		job.Cmd.Kill()
+	}
+}
+
+// ParseSignal returns the signal with the
+// given name, such as "TERM" or "SIGTERM",
+// or number, such as "15".
+func ParseSignal(name string) (os.Signal, bool) {
+	name = strings.TrimPrefix(strings.ToUpper(name), "SIG")
+
+	if sig, ok := signals[name]; ok {
+		return sig, true
+	}
+
+	if n, err := strconv.Atoi(name); err == nil {
+		for _, sig := range signals {
+			if int(sig) == n {
+				return sig, true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+// SignalName returns the name of
+// the signal, such as "TERM"
+func SignalName(sig os.Signal) string {
+	for name, s := range signals {
+		if s == sig {
+			return name
+		}
+	}
+
+	return sig.String()
+}
+
+// SignalNames returns the names of
+// the signals that can be sent to
+// commands
+func SignalNames() []string {
+	names := []string{}
+
+	for name := range signals {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,526 @@
+package object
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/abs-lang/abs/token"
+)
+
+// JsonError is returned when a JSON document
+// cannot be decoded. Line and Column point to
+// the character that caused the error.
+type JsonError struct {
+	Message string
+	Line    int
+	Column  int
+}
+
+func (e *JsonError) Error() string {
+	return fmt.Sprintf("%s at [%d:%d]", e.Message, e.Line, e.Column)
+}
+
+// DecodeJson converts a JSON document (RFC 8259)
+// to an ABS object: objects become hashes (keeping
+// the order of their keys), arrays become arrays
+// and so on. Any value, not just objects or arrays,
+// is accepted at the top level.
+func DecodeJson(input string) (Object, error) {
+	d := &jsonDecoder{input: input}
+
+	d.skipWhitespace()
+	value, err := d.decodeValue()
+	if err != nil {
+		return nil, err
+	}
+
+	d.skipWhitespace()
+	if d.pos < len(d.input) {
+		return nil, d.unexpected("end of input")
+	}
+
+	return value, nil
+}
+
+type jsonDecoder struct {
+	input string
+	pos   int
+}
+
+// errorAt builds an error pointing to the
+// given offset of the input.
+func (d *jsonDecoder) errorAt(pos int, format string, args ...interface{}) error {
+	line := strings.Count(d.input[:pos], "\n") + 1
+	begin := strings.LastIndex(d.input[:pos], "\n") + 1
+	column := utf8.RuneCountInString(d.input[begin:pos]) + 1
+
+	return &JsonError{Message: fmt.Sprintf(format, args...), Line: line, Column: column}
+}
+
+// unexpected reports the character at the current
+// position of the decoder, and what we were
+// expecting to find instead.
+func (d *jsonDecoder) unexpected(expected string) error {
+	if d.pos >= len(d.input) {
+		return d.errorAt(d.pos, "unexpected end of input, expected %s", expected)
+	}
+
+	r, _ := utf8.DecodeRuneInString(d.input[d.pos:])
+
+	return d.errorAt(d.pos, "unexpected character %s, expected %s", strconv.QuoteRune(r), expected)
+}
+
+func (d *jsonDecoder) skipWhitespace() {
+	for d.pos < len(d.input) {
+		switch d.input[d.pos] {
+		case ' ', '\t', '\n', '\r':
+			d.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (d *jsonDecoder) decodeValue() (Object, error) {
+	if d.pos >= len(d.input) {
+		return nil, d.unexpected("a value")
+	}
+
+	switch c := d.input[d.pos]; {
+	case c == '{':
+		return d.decodeObject()
+	case c == '[':
+		return d.decodeArray()
+	case c == '"':
+		s, err := d.decodeString()
+		if err != nil {
+			return nil, err
+		}
+
+		return &String{Value: s}, nil
+	case c == '-' || (c >= '0' && c <= '9'):
+		return d.decodeNumber()
+	case strings.HasPrefix(d.input[d.pos:], "true"):
+		d.pos += len("true")
+		return TRUE, nil
+	case strings.HasPrefix(d.input[d.pos:], "false"):
+		d.pos += len("false")
+		return FALSE, nil
+	case strings.HasPrefix(d.input[d.pos:], "null"):
+		d.pos += len("null")
+		return NULL, nil
+	}
+
+	return nil, d.unexpected("a value")
+}
+
+func (d *jsonDecoder) decodeObject() (Object, error) {
+	hash := &Hash{Pairs: make(map[HashKey]HashPair)}
+	d.pos++ // {
+	d.skipWhitespace()
+
+	if d.pos < len(d.input) && d.input[d.pos] == '}' {
+		d.pos++
+		return hash, nil
+	}
+
+	for {
+		if d.pos >= len(d.input) || d.input[d.pos] != '"' {
+			return nil, d.unexpected("a string key")
+		}
+
+		k, err := d.decodeString()
+		if err != nil {
+			return nil, err
+		}
+
+		d.skipWhitespace()
+		if d.pos >= len(d.input) || d.input[d.pos] != ':' {
+			return nil, d.unexpected("':'")
+		}
+		d.pos++
+		d.skipWhitespace()
+
+		value, err := d.decodeValue()
+		if err != nil {
+			return nil, err
+		}
+
+		key := &String{Value: k}
+		hash.Set(key.HashKey(), HashPair{Key: key, Value: value})
+
+		d.skipWhitespace()
+		if d.pos < len(d.input) && d.input[d.pos] == ',' {
+			d.pos++
+			d.skipWhitespace()
+			continue
+		}
+
+		if d.pos < len(d.input) && d.input[d.pos] == '}' {
+			d.pos++
+			return hash, nil
+		}
+
+		return nil, d.unexpected("',' or '}'")
+	}
+}
+
+func (d *jsonDecoder) decodeArray() (Object, error) {
+	array := &Array{Elements: []Object{}}
+	d.pos++ // [
+	d.skipWhitespace()
+
+	if d.pos < len(d.input) && d.input[d.pos] == ']' {
+		d.pos++
+		return array, nil
+	}
+
+	for {
+		value, err := d.decodeValue()
+		if err != nil {
+			return nil, err
+		}
+
+		array.Elements = append(array.Elements, value)
+
+		d.skipWhitespace()
+		if d.pos < len(d.input) && d.input[d.pos] == ',' {
+			d.pos++
+			d.skipWhitespace()
+			continue
+		}
+
+		if d.pos < len(d.input) && d.input[d.pos] == ']' {
+			d.pos++
+			return array, nil
+		}
+
+		return nil, d.unexpected("',' or ']'")
+	}
+}
+
+// decodeString reads a string, starting from its
+// opening quote, and resolves its escape sequences.
+// Invalid UTF-8 and lone surrogates are replaced
+// with the unicode replacement character.
+func (d *jsonDecoder) decodeString() (string, error) {
+	var out strings.Builder
+	start := d.pos
+	d.pos++ // "
+
+	for {
+		if d.pos >= len(d.input) {
+			return "", d.errorAt(start, "unterminated string")
+		}
+
+		c := d.input[d.pos]
+
+		switch {
+		case c == '"':
+			d.pos++
+			return out.String(), nil
+		case c < 0x20:
+			return "", d.errorAt(d.pos, "invalid control character %s in string", strconv.QuoteRune(rune(c)))
+		case c == '\\':
+			if err := d.decodeEscape(&out); err != nil {
+				return "", err
+			}
+		default:
+			r, size := utf8.DecodeRuneInString(d.input[d.pos:])
+			out.WriteRune(r)
+			d.pos += size
+		}
+	}
+}
+
+var jsonEscapes = map[byte]rune{
+	'"':  '"',
+	'\\': '\\',
+	'/':  '/',
+	'b':  '\b',
+	'f':  '\f',
+	'n':  '\n',
+	'r':  '\r',
+	't':  '\t',
+}
+
+func (d *jsonDecoder) decodeEscape(out *strings.Builder) error {
+	start := d.pos
+	d.pos++ // \
+
+	if d.pos >= len(d.input) {
+		return d.unexpected("an escape sequence")
+	}
+
+	if r, ok := jsonEscapes[d.input[d.pos]]; ok {
+		out.WriteRune(r)
+		d.pos++
+		return nil
+	}
+
+	if d.input[d.pos] != 'u' {
+		return d.errorAt(start, "invalid escape sequence %s", strconv.Quote(d.input[start:d.pos+1]))
+	}
+
+	r, err := d.decodeUnicode(start)
+	if err != nil {
+		return err
+	}
+
+	// Characters outside of the basic multilingual
+	// plane are encoded as a surrogate pair, such
+	// as 😀
+	if utf16.IsSurrogate(r) && strings.HasPrefix(d.input[d.pos:], `\u`) {
+		next := d.pos
+		d.pos++ // \
+
+		r2, err := d.decodeUnicode(next)
+		if err != nil {
+			return err
+		}
+
+		if pair := utf16.DecodeRune(r, r2); pair != utf8.RuneError {
+			out.WriteRune(pair)
+			return nil
+		}
+
+		out.WriteRune(utf8.RuneError)
+		r = r2
+	}
+
+	if utf16.IsSurrogate(r) {
+		r = utf8.RuneError
+	}
+
+	out.WriteRune(r)
+
+	return nil
+}
+
+// decodeUnicode reads the 4 hex digits of an
+// \uXXXX escape sequence: the decoder must be
+// positioned on the 'u'.
+func (d *jsonDecoder) decodeUnicode(start int) (rune, error) {
+	d.pos++ // u
+
+	if d.pos+4 > len(d.input) {
+		return 0, d.errorAt(start, "invalid unicode escape sequence %s", strconv.Quote(d.input[start:]))
+	}
+
+	code, err := strconv.ParseUint(d.input[d.pos:d.pos+4], 16, 32)
+	if err != nil {
+		return 0, d.errorAt(start, "invalid unicode escape sequence %s", strconv.Quote(d.input[start:d.pos+4]))
+	}
+
+	d.pos += 4
+
+	return rune(code), nil
+}
+
+// decodeNumber reads a number such as -12.5e3.
+// Integers beyond 2^53 are kept exact by
+// using arbitrary-precision numbers.
+func (d *jsonDecoder) decodeNumber() (Object, error) {
+	start := d.pos
+	isInt := true
+
+	digits := func() int {
+		n := 0
+		for d.pos < len(d.input) && d.input[d.pos] >= '0' && d.input[d.pos] <= '9' {
+			d.pos++
+			n++
+		}
+		return n
+	}
+
+	if d.input[d.pos] == '-' {
+		d.pos++
+	}
+
+	if d.pos < len(d.input) && d.input[d.pos] == '0' {
+		d.pos++
+	} else if digits() == 0 {
+		return nil, d.unexpected("a digit")
+	}
+
+	if d.pos < len(d.input) && d.input[d.pos] == '.' {
+		isInt = false
+		d.pos++
+
+		if digits() == 0 {
+			return nil, d.unexpected("a digit")
+		}
+	}
+
+	if d.pos < len(d.input) && (d.input[d.pos] == 'e' || d.input[d.pos] == 'E') {
+		isInt = false
+		d.pos++
+
+		if d.pos < len(d.input) && (d.input[d.pos] == '+' || d.input[d.pos] == '-') {
+			d.pos++
+		}
+
+		if digits() == 0 {
+			return nil, d.unexpected("a digit")
+		}
+	}
+
+	literal := d.input[start:d.pos]
+
+	if isInt {
+		i, _ := new(big.Int).SetString(literal, 10)
+		return NewBigNumber(token.Token{}, i), nil
+	}
+
+	f, err := strconv.ParseFloat(literal, 64)
+	if err != nil {
+		return nil, d.errorAt(start, "number %s is out of range", literal)
+	}
+
+	return &Number{Value: f}, nil
+}
+
+// EncodeJson converts an object to JSON (RFC 8259).
+// When indent is not empty, nested values are
+// placed on their own line and indented; when
+// sortKeys is true, the keys of hashes are sorted
+// alphabetically rather than in insertion order.
+func EncodeJson(o Object, indent string, sortKeys bool) string {
+	var out strings.Builder
+	encodeJson(&out, o, indent, sortKeys, 0)
+
+	return out.String()
+}
+
+func encodeJson(out *strings.Builder, o Object, indent string, sortKeys bool, depth int) {
+	// separators between elements, and between
+	// keys and values
+	sep, colon := ", ", ": "
+	newline := func(depth int) {}
+
+	if indent != "" {
+		sep = ","
+		newline = func(depth int) {
+			out.WriteString("\n")
+			out.WriteString(strings.Repeat(indent, depth))
+		}
+	}
+
+	switch o := o.(type) {
+	case *Array:
+		if len(o.Elements) == 0 {
+			out.WriteString("[]")
+			return
+		}
+
+		out.WriteString("[")
+		for i, e := range o.Elements {
+			if i > 0 {
+				out.WriteString(sep)
+			}
+			newline(depth + 1)
+			encodeJson(out, e, indent, sortKeys, depth+1)
+		}
+		newline(depth)
+		out.WriteString("]")
+	case *Hash:
+		// JSON only allows strings as keys, so
+		// numbers, booleans and null are converted
+		// to their string representation. When keys
+		// collide, such as 1 and "1", the last value
+		// wins and the key keeps its first position
+		keys := []string{}
+		values := map[string]Object{}
+		for _, pair := range o.OrderedPairs() {
+			key := pair.Key.Inspect()
+			if _, ok := values[key]; !ok {
+				keys = append(keys, key)
+			}
+			values[key] = pair.Value
+		}
+
+		if len(keys) == 0 {
+			out.WriteString("{}")
+			return
+		}
+
+		if sortKeys {
+			sort.Strings(keys)
+		}
+
+		out.WriteString("{")
+		for i, key := range keys {
+			if i > 0 {
+				out.WriteString(sep)
+			}
+			newline(depth + 1)
+			out.WriteString(jsonString(key))
+			out.WriteString(colon)
+			encodeJson(out, values[key], indent, sortKeys, depth+1)
+		}
+		newline(depth)
+		out.WriteString("}")
+	case *Error:
+		encodeJson(out, o.hash(), indent, sortKeys, depth)
+	case *ReturnValue:
+		encodeJson(out, o.Value, indent, sortKeys, depth)
+	default:
+		out.WriteString(o.Json())
+	}
+}
+
+// jsonString quotes a string, escaping quotes,
+// backslashes and control characters. Invalid
+// UTF-8 is replaced with the unicode replacement
+// character.
+func jsonString(s string) string {
+	var out strings.Builder
+	out.WriteByte('"')
+
+	for _, r := range s {
+		switch r {
+		case '"':
+			out.WriteString(`\"`)
+		case '\\':
+			out.WriteString(`\\`)
+		case '\b':
+			out.WriteString(`\b`)
+		case '\f':
+			out.WriteString(`\f`)
+		case '\n':
+			out.WriteString(`\n`)
+		case '\r':
+			out.WriteString(`\r`)
+		case '\t':
+			out.WriteString(`\t`)
+		default:
+			if r < 0x20 {
+				fmt.Fprintf(&out, `\u%04x`, r)
+				continue
+			}
+
+			out.WriteRune(r)
+		}
+	}
+
+	out.WriteByte('"')
+
+	return out.String()
+}
+
+// jsonNumber returns the JSON representation of a
+// number: since JSON has no way to represent NaN
+// or infinity, they are converted to null.
+func jsonNumber(n *Number) string {
+	if n.Big == nil && (math.IsNaN(n.Value) || math.IsInf(n.Value, 0)) {
+		return "null"
+	}
+
+	return n.Inspect()
+}
@@ -1,16 +1,24 @@
 package object
 
 import (
+	"bufio"
 	"bytes"
 	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"os"
 	"os/exec"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/abs-lang/abs/ast"
+	"github.com/abs-lang/abs/lexer"
 	"github.com/abs-lang/abs/token"
+	"github.com/mattn/go-isatty"
 )
 
 type BuiltinFunction func(tok token.Token, env *Environment, args ...Object) Object
@@ -68,7 +76,44 @@ type Object interface {
 // string representation wouldn't work as "1" would
 // be the same as 1.
 func GenerateEqualityString(o Object) string {
-	return fmt.Sprintf("%s:%s", o.Type(), o.Inspect())
+	return fmt.Sprintf("%s:%s", o.Type(), equalityValue(o))
+}
+
+// equalityValue returns the representation of an
+// object used to compare it with others. Hashes
+// are equal regardless of the order of their keys,
+// so their keys are sorted, even when nested.
+func equalityValue(o Object) string {
+	switch o := o.(type) {
+	case *Hash:
+		keys := append([]HashKey{}, o.OrderedKeys()...)
+		SortHashKeys(keys)
+
+		pairs := []string{}
+		for _, k := range keys {
+			pair := o.Pairs[k]
+			pairs = append(pairs, fmt.Sprintf(`%s: %s`, equalityElement(pair.Key), equalityElement(pair.Value)))
+		}
+
+		return "{" + strings.Join(pairs, ", ") + "}"
+	case *Array:
+		elements := []string{}
+		for _, e := range o.Elements {
+			elements = append(elements, equalityElement(e))
+		}
+
+		return "[" + strings.Join(elements, ", ") + "]"
+	}
+
+	return o.Inspect()
+}
+
+func equalityElement(o Object) string {
+	if s, ok := o.(*String); ok {
+		return s.Json()
+	}
+
+	return equalityValue(o)
 }
 
 // Equal compares 2 objects
@@ -83,9 +128,35 @@ type Iterable interface {
 	Reset()
 }
 
+// MaxExactInt is the largest integer a float64
+// can represent without losing precision (2^53)
+const MaxExactInt = 1 << 53
+
+var maxExactInt = big.NewInt(MaxExactInt)
+
 type Number struct {
 	Token token.Token
 	Value float64
+	// Integers that cannot be represented exactly
+	// by a float64 (beyond ±2^53) are backed by an
+	// arbitrary-precision integer. Value still holds
+	// their (approximate) float representation, so
+	// that code that doesn't care about precision
+	// can keep using it.
+	Big *big.Int
+}
+
+// NewBigNumber returns a number representing the given
+// integer: if it fits in a float64 without losing precision
+// we simply use a float, else we keep the big.Int around.
+func NewBigNumber(tok token.Token, i *big.Int) *Number {
+	f, _ := new(big.Float).SetInt(i).Float64()
+
+	if i.CmpAbs(maxExactInt) <= 0 {
+		return &Number{Token: tok, Value: f}
+	}
+
+	return &Number{Token: tok, Value: f, Big: i}
 }
 
 func (n *Number) Type() ObjectType { return NUMBER_OBJ }
@@ -95,18 +166,60 @@ func (n *Number) Type() ObjectType { return NUMBER_OBJ }
 // If it's a float, let's remove as many zeroes
 // as possible (1.10000 becomes 1.1).
 func (n *Number) Inspect() string {
+	if n.Big != nil {
+		return n.Big.String()
+	}
+
 	if n.IsInt() {
 		return fmt.Sprintf("%d", int64(n.Value))
 	}
 	return strconv.FormatFloat(n.Value, 'f', -1, 64)
 }
 func (n *Number) IsInt() bool {
-	return n.Value == float64(int64(n.Value))
+	return n.Big != nil || n.Value == float64(int64(n.Value))
+}
+
+// BigInt returns the integer part of the number
+// as an arbitrary-precision integer. Infinity and
+// NaN, which have no integer representation, are
+// converted to 0.
+func (n *Number) BigInt() *big.Int {
+	if n.Big != nil {
+		return new(big.Int).Set(n.Big)
+	}
+
+	if math.IsInf(n.Value, 0) || math.IsNaN(n.Value) {
+		return new(big.Int)
+	}
+
+	i, _ := big.NewFloat(n.Value).Int(nil)
+
+	return i
+}
+
+// BigFloat returns the exact value of the number
+// as an arbitrary-precision float, so that it can
+// be compared with other numbers without losing
+// precision.
+func (n *Number) BigFloat() *big.Float {
+	if n.Big != nil {
+		return new(big.Float).SetInt(n.Big)
+	}
+
+	return big.NewFloat(n.Value)
 }
-func (n *Number) Json() string       { return n.Inspect() }
+func (n *Number) Json() string       { return jsonNumber(n) }
 func (n *Number) ZeroValue() float64 { return float64(0) }
 func (n *Number) Int() int           { return int(n.Value) }
 
+// Numbers are hashed through their printed
+// representation, so that 1 and 1.0 point to
+// the same key, and big integers keep all of
+// their digits.
+func (n *Number) HashKey() HashKey {
+	return HashKey{Type: n.Type(), Value: n.Inspect()}
+}
+
 type Boolean struct {
 	Token token.Token
 	Value bool
@@ -115,6 +228,9 @@ type Boolean struct {
 func (b *Boolean) Type() ObjectType { return BOOLEAN_OBJ }
 func (b *Boolean) Inspect() string  { return fmt.Sprintf("%t", b.Value) }
 func (b *Boolean) Json() string     { return b.Inspect() }
+func (b *Boolean) HashKey() HashKey {
+	return HashKey{Type: b.Type(), Value: b.Inspect()}
+}
 
 type Null struct {
 	Token token.Token
@@ -123,6 +239,9 @@ type Null struct {
 func (n *Null) Type() ObjectType { return NULL_OBJ }
 func (n *Null) Inspect() string  { return "null" }
 func (n *Null) Json() string     { return n.Inspect() }
+func (n *Null) HashKey() HashKey {
+	return HashKey{Type: n.Type(), Value: n.Inspect()}
+}
 
 type ReturnValue struct {
 	Token token.Token
@@ -131,15 +250,137 @@ type ReturnValue struct {
 
 func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
 func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
-func (rv *ReturnValue) Json() string     { return rv.Inspect() }
+func (rv *ReturnValue) Json() string     { return rv.Value.Json() }
+
+// Kinds of errors raised by the interpreter.
+// Users can define their own kinds through
+// error("message", "MyKind").
+const (
+	GENERIC_ERROR  = "Error"
+	TYPE_ERROR     = "TypeError"
+	NAME_ERROR     = "NameError"
+	INDEX_ERROR    = "IndexError"
+	ARGUMENT_ERROR = "ArgumentError"
+	IMPORT_ERROR   = "ImportError"
+	KEY_ERROR      = "KeyError"
+	COMMAND_ERROR  = "CommandError"
+	IO_ERROR       = "IOError"
+	HTTP_ERROR     = "HTTPError"
+)
+
+// Frame represents a location in the code
+// an error went through, such as the line
+// where it was raised.
+type Frame struct {
+	Function string
+	File     string
+	Line     int
+	Column   int
+	// The line of code the frame points to
+	Code string
+}
+
+// String returns the position of the frame, eg.
+// [3:5] or script.abs:[3:5]
+func (f Frame) String() string {
+	if f.File == "" {
+		return fmt.Sprintf("[%d:%d]", f.Line, f.Column)
+	}
+
+	return fmt.Sprintf("%s:[%d:%d]", f.File, f.Line, f.Column)
+}
 
 type Error struct {
 	Message string
+	Kind    string
+	// Where the error was raised:
+	// the file is empty when running
+	// code from the REPL
+	Line   int
+	Column int
+	File   string
+	// The line of code that raised the error
+	Code string
+	// The frames the error went through,
+	// starting from where it was raised
+	Stack []Frame
+	// The command that raised the error,
+	// if it failed in strict mode
+	Cmd *String
+	// An error that's been intercepted by
+	// a try...catch block is not an error
+	// anymore, but rather a regular value
+	// that can be passed around without
+	// halting the program -- until someone
+	// decides to throw it again.
+	Caught bool
 }
 
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
-func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
-func (e *Error) Json() string     { return e.Inspect() }
+
+// Inspect returns the error message, followed by
+// the position and line of code that raised it:
+//
+// ERROR: type mismatch: NUMBER + STRING
+//
+//	[2:3]	1 + "hello"
+func (e *Error) Inspect() string {
+	if e.Line == 0 {
+		return "ERROR: " + e.Message
+	}
+
+	return fmt.Sprintf("ERROR: %s\n\t[%d:%d]\t%s", e.Message, e.Line, e.Column, e.Code)
+}
+func (e *Error) Json() string { return e.hash().Json() }
+
+// hash returns the properties of the error,
+// so that it can be encoded to JSON.
+func (e *Error) hash() *Hash {
+	values := []HashPair{
+		{Key: &String{Value: "message"}, Value: &String{Value: e.Message}},
+		{Key: &String{Value: "kind"}, Value: &String{Value: e.Kind}},
+		{Key: &String{Value: "file"}, Value: &String{Value: e.File}},
+		{Key: &String{Value: "line"}, Value: &Number{Value: float64(e.Line)}},
+		{Key: &String{Value: "column"}, Value: &Number{Value: float64(e.Column)}},
+	}
+
+	if e.Cmd != nil {
+		values = append(values,
+			HashPair{Key: &String{Value: "command"}, Value: &String{Value: e.Cmd.Command}},
+			HashPair{Key: &String{Value: "stderr"}, Value: &String{Value: e.Cmd.Stderr.String()}},
+			HashPair{Key: &String{Value: "exit_code"}, Value: &Number{Value: float64(e.Cmd.ExitCode)}},
+		)
+	}
+
+	return NewHashFromPairs(token.Token{}, values)
+}
+
+// Traceback returns the stack of calls that led
+// to the error, most recent call last:
+//
+// Traceback (most recent call last):
+//
+//	script.abs:[5:1] in <main>
+//		divide(1, 0)
+//	script.abs:[2:5] in divide
+//		throw "cannot divide by zero"
+//
+// ERROR: cannot divide by zero
+func (e *Error) Traceback() string {
+	var out bytes.Buffer
+
+	out.WriteString("Traceback (most recent call last):\n")
+
+	for i := len(e.Stack) - 1; i >= 0; i-- {
+		frame := e.Stack[i]
+		out.WriteString(fmt.Sprintf("\t%s in %s\n", frame.String(), frame.Function))
+		out.WriteString(fmt.Sprintf("\t\t%s\n", strings.TrimSpace(frame.Code)))
+	}
+
+	out.WriteString("ERROR: " + e.Message)
+
+	return out.String()
+}
 
 type BreakError struct {
 	Error
@@ -149,6 +390,16 @@ type ContinueError struct {
 	Error
 }
 
+// ExitError is raised by exit(...): it stops
+// the script just like any other error, so
+// that deferred code and functions registered
+// through at_exit(...) still get to run, but
+// cannot be caught.
+type ExitError struct {
+	Error
+	Code int
+}
+
 type Function struct {
 	Token      token.Token
 	Name       string
@@ -156,6 +407,11 @@ type Function struct {
 	Body       *ast.BlockStatement
 	Env        *Environment
 	Node       *ast.FunctionLiteral
+	// Where the function was defined, so that
+	// errors raised within its body can be
+	// located in the right file
+	Lexer *lexer.Lexer
+	File  string
 }
 
 func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
@@ -182,7 +438,7 @@ func (f *Function) Inspect() string {
 	return out.String()
 }
 
-func (f *Function) Json() string { return f.Inspect() }
+func (f *Function) Json() string { return jsonString(f.Inspect()) }
 
 // The String is a special fella.
 //
@@ -211,19 +467,32 @@ func (f *Function) Json() string { return f.Inspect() }
 // cmd.wait() // ...
 // cmd.done // TRUE
 type String struct {
-	Token  token.Token
-	Value  string
-	Ok     *Boolean  // A special property to check whether a command exited correctly
-	Cmd    *exec.Cmd // A special property to access the underlying command
-	Stdout *bytes.Buffer
-	Stderr *bytes.Buffer
-	Done   *Boolean
-	mux    *sync.Mutex
+	Token    token.Token
+	Value    string
+	Ok       *Boolean  // A special property to check whether a command exited correctly
+	Cmd      *exec.Cmd // A special property to access the underlying command
+	Command  string    // The command line, such as "ls -la"
+	Stdout   *bytes.Buffer
+	Stderr   *bytes.Buffer
+	Done     *Boolean
+	ExitCode int           // The exit status of the command, -1 if it could not start or was killed by a signal
+	Started  time.Time     // When the command was started
+	Duration time.Duration // How long the command took to run
+	Lines    *bufio.Reader // The output of a streamed command, read line by line
+	Timeout  time.Duration // How long the command can run for before being killed, along with its children
+	TimedOut bool          // Whether the command was killed because it ran past its timeout
+	Safe     bool          // Whether the command is run even in dry-run mode
+	Detached bool          // Whether the command was written to run in background, as in `cmd &`
+	line     int
+	drained  bool
+	timer    *time.Timer
+	finished chan struct{}
+	mux      *sync.Mutex
 }
 
 func (s *String) Type() ObjectType  { return STRING_OBJ }
 func (s *String) Inspect() string   { return s.Value }
-func (s *String) Json() string      { return `"` + strings.ReplaceAll(s.Inspect(), `"`, `\"`) + `"` }
+func (s *String) Json() string      { return jsonString(s.Value) }
 func (s *String) ZeroValue() string { return "" }
 func (s *String) HashKey() HashKey {
 	return HashKey{Type: s.Type(), Value: s.Value}
@@ -243,6 +512,7 @@ func (s *String) mustHaveMutex() {
 // mutex.
 func (s *String) SetDone() {
 	s.mustHaveMutex()
+	close(s.finished)
 	s.mux.Unlock()
 }
 
@@ -253,46 +523,203 @@ func (s *String) SetDone() {
 func (s *String) SetRunning() {
 	s.mustHaveMutex()
 	s.mux.Lock()
+	s.finished = make(chan struct{})
+}
+
+// Finished returns a channel that is
+// closed once the command is done.
+// If the command isn't running, the
+// channel is closed already.
+func (s *String) Finished() <-chan struct{} {
+	if s.finished == nil {
+		c := make(chan struct{})
+		close(c)
+		return c
+	}
+
+	return s.finished
+}
+
+// Running returns whether the command is
+// still running in background. Until it's
+// done, its result is being written by
+// whoever waits for it, and cannot be read.
+func (s *String) Running() bool {
+	select {
+	case <-s.Finished():
+		return false
+	default:
+		return true
+	}
 }
 
 // To be called when we want to
 // wait on the background command
 // to be done.
+//
+// If the command is being streamed,
+// the rest of its output is discarded,
+// else the command could block forever
+// trying to write it.
 func (s *String) Wait() {
+	for s.Lines != nil && !s.drained {
+		s.NextLine()
+	}
+
 	s.mustHaveMutex()
 	s.mux.Lock()
 	s.mux.Unlock()
 }
 
-// To be called when we want to
-// kill the background command
-func (s *String) Kill() error {
-	err := s.Cmd.Process.Kill()
+// NextLine returns the next line written
+// by a streamed command, blocking until
+// the command writes it. Since the command
+// cannot write more than the pipe can hold,
+// a slow reader will slow the command down
+// rather than buffering its output.
+//
+// Once the output is over, we wait for the
+// command to exit and set its result.
+func (s *String) NextLine() (Object, Object) {
+	if s.Lines == nil || s.drained {
+		return nil, EOF
+	}
+
+	line, err := s.Lines.ReadString('\n')
+
+	if err != nil && line == "" {
+		s.drained = true
+		Ok := TRUE
+
+		if s.WaitCmd() != nil {
+			Ok = FALSE
+		}
 
-	// The command value includes output and possible error
-	// We might want to change this
-	output := s.Stdout.String()
-	outputErr := s.Stderr.String()
-	s.Value = strings.TrimSpace(output) + strings.TrimSpace(outputErr)
+		s.SetCmdResult(Ok)
+		s.SetDone()
+		return nil, EOF
+	}
+
+	k := &Number{Value: float64(s.line)}
+	s.line++
+
+	return k, &String{Token: s.Token, Value: strings.TrimRight(line, "\r\n")}
+}
 
+// StartCmd starts the underlying command.
+// If the command has a timeout, it runs in
+// its own process group, so that it can be
+// killed along with all of its children once
+// the timeout expires.
+//
+// Commands reading from the terminal are the
+// exception: in their own process group they
+// couldn't read from it, nor receive Ctrl-C,
+// so only the command itself is killed.
+func (s *String) StartCmd() error {
+	if s.Timeout > 0 && !isTerminal(s.Cmd.Stdin) {
+		SetProcessGroup(s.Cmd)
+	}
+
+	err := s.Cmd.Start()
 	if err != nil {
 		return err
 	}
 
-	s.Done = TRUE
+	if s.Timeout > 0 {
+		s.timer = time.AfterFunc(s.Timeout, func() {
+			killProcess(s.Cmd)
+		})
+	}
+
 	return nil
 }
 
+// isTerminal tells whether the input
+// of a command is a terminal.
+func isTerminal(r io.Reader) bool {
+	f, ok := r.(*os.File)
+
+	return ok && isatty.IsTerminal(f.Fd())
+}
+
+// WaitCmd waits for the underlying
+// command to exit, recording whether
+// it was killed by its timeout.
+func (s *String) WaitCmd() error {
+	err := s.Cmd.Wait()
+
+	// If the timer cannot be stopped,
+	// it has already fired
+	if s.timer != nil && !s.timer.Stop() {
+		s.TimedOut = true
+	}
+
+	return err
+}
+
+// RunCmd starts the underlying command
+// and waits for it to exit.
+func (s *String) RunCmd() error {
+	err := s.StartCmd()
+	if err != nil {
+		return err
+	}
+
+	return s.WaitCmd()
+}
+
+// Signal sends a signal to the command
+// and, if it leads its own process group,
+// to all of its children.
+func (s *String) Signal(sig os.Signal) error {
+	return signalProcess(s.Cmd, sig)
+}
+
+// To be called when we want to
+// kill the background command.
+// The command is only killed here:
+// its result is recorded by whoever
+// waits for it to exit.
+func (s *String) Kill() error {
+	return killProcess(s.Cmd)
+}
+
+// SetDryRun marks the command as successful,
+// with no output, without running it: in dry-run
+// mode commands are only printed.
+func (s *String) SetDryRun() {
+	s.Ok = TRUE
+	s.Done = TRUE
+	s.ExitCode = 0
+	s.Value = ""
+	s.drained = true
+}
+
 // Sets the result of the underlying command
 // on the string.
-// 3 things are set:
+// These things are set:
 // - the string itself (output of the command)
 // - str.ok
 // - str.done
+// - the exit code and duration of the command
+//
+// The output of the command is still available,
+// regardless of its result, through s.Stdout
+// and s.Stderr.
 func (s *String) SetCmdResult(Ok *Boolean) {
 	s.Ok = Ok
 	var output string
 
+	s.ExitCode = -1
+	if s.Cmd != nil && s.Cmd.ProcessState != nil {
+		s.ExitCode = s.Cmd.ProcessState.ExitCode()
+	}
+
+	if !s.Started.IsZero() {
+		s.Duration = time.Since(s.Started)
+	}
+
 	if Ok.Value {
 		output = s.Stdout.String()
 	} else {
@@ -310,6 +737,11 @@ type Builtin struct {
 	Next     func() (Object, Object)
 	Types    []string
 	Iterable bool
+	// Whether commands passed to this builtin
+	// function, as in fn(`cmd`) or fn("cmd $x"),
+	// should be handed to it as written, so that
+	// the function can run them on its own terms.
+	RawCommands bool
 	// Whether this builtin function
 	// is intended to be primarily used
 	// as a function or method:
@@ -330,7 +762,7 @@ type Builtin struct {
 
 func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
 func (b *Builtin) Inspect() string  { return "builtin function" }
-func (b *Builtin) Json() string     { return b.Inspect() }
+func (b *Builtin) Json() string     { return jsonString(b.Inspect()) }
 
 type Array struct {
 	Token    token.Token
@@ -387,7 +819,7 @@ func (ao *Array) Inspect() string {
 
 	elements := []string{}
 	for _, e := range ao.Elements {
-		elements = append(elements, e.Json())
+		elements = append(elements, inspectElement(e))
 	}
 
 	out.WriteString("[")
@@ -397,16 +829,34 @@ func (ao *Array) Inspect() string {
 	return out.String()
 }
 
-func (ao *Array) Json() string { return ao.Inspect() }
+func (ao *Array) Json() string { return EncodeJson(ao, "", false) }
+
+// inspectElement returns the representation of an
+// object nested within an array or an hash: strings
+// are quoted, while everything else is inspected.
+func inspectElement(o Object) string {
+	if s, ok := o.(*String); ok {
+		return s.Json()
+	}
+
+	return o.Inspect()
+}
 
 type HashPair struct {
 	Key   Object
 	Value Object
 }
 
+// Hashes remember the order in which their keys
+// were inserted: Pairs allows O(1) lookups, while
+// Keys tracks the insertion order, which is used
+// when iterating, inspecting or encoding the hash.
+// Pairs should be modified through Set and Delete
+// so that the two stay in sync.
 type Hash struct {
 	Token    token.Token
 	Pairs    map[HashKey]HashPair
+	Keys     []HashKey
 	Position int
 }
 
@@ -417,6 +867,107 @@ func (h *Hash) GetPair(key string) (HashPair, bool) {
 	return record, ok
 }
 
+// NewHashFromPairs creates an hash holding
+// the given pairs, in the order they're given.
+// Keys must be hashable, such as strings.
+func NewHashFromPairs(tok token.Token, pairs []HashPair) *Hash {
+	h := &Hash{Token: tok}
+	for _, pair := range pairs {
+		h.Set(pair.Key.(Hashable).HashKey(), pair)
+	}
+
+	return h
+}
+
+// Set adds a pair to the hash. New keys are
+// appended at the end of the hash, while
+// existing ones keep their position.
+func (h *Hash) Set(hashKey HashKey, pair HashPair) {
+	if h.Pairs == nil {
+		h.Pairs = make(map[HashKey]HashPair)
+	}
+
+	if _, ok := h.Pairs[hashKey]; !ok {
+		h.OrderedKeys()
+		h.Keys = append(h.Keys, hashKey)
+	}
+
+	h.Pairs[hashKey] = pair
+}
+
+// Delete removes a key from the hash.
+func (h *Hash) Delete(hashKey HashKey) {
+	if _, ok := h.Pairs[hashKey]; !ok {
+		return
+	}
+
+	delete(h.Pairs, hashKey)
+
+	for i, k := range h.Keys {
+		if k == hashKey {
+			h.Keys = append(h.Keys[:i:i], h.Keys[i+1:]...)
+			break
+		}
+	}
+}
+
+// OrderedKeys returns the keys of the hash in
+// insertion order.
+// If Pairs has been modified without going through
+// Set or Delete, the keys are re-synced: known keys
+// keep their position and unknown ones are appended,
+// sorted, at the end.
+func (h *Hash) OrderedKeys() []HashKey {
+	if len(h.Keys) == len(h.Pairs) {
+		return h.Keys
+	}
+
+	keys := []HashKey{}
+	seen := map[HashKey]bool{}
+	for _, k := range h.Keys {
+		if _, ok := h.Pairs[k]; ok && !seen[k] {
+			seen[k] = true
+			keys = append(keys, k)
+		}
+	}
+
+	missing := []HashKey{}
+	for k := range h.Pairs {
+		if !seen[k] {
+			missing = append(missing, k)
+		}
+	}
+	SortHashKeys(missing)
+
+	h.Keys = append(keys, missing...)
+
+	return h.Keys
+}
+
+// OrderedPairs returns the pairs of the hash
+// in insertion order.
+func (h *Hash) OrderedPairs() []HashPair {
+	pairs := []HashPair{}
+	for _, k := range h.OrderedKeys() {
+		pairs = append(pairs, h.Pairs[k])
+	}
+
+	return pairs
+}
+
+// SortHashKeys sorts keys alphabetically, based on
+// their value. Keys with the same value, such as
+// 1 and "1", are then sorted by type.
+func SortHashKeys(keys []HashKey) {
+	sort.SliceStable(keys, func(i, j int) bool {
+		if keys[i].Value == keys[j].Value {
+			return keys[i].Type < keys[j].Type
+		}
+
+		return keys[i].Value < keys[j].Value
+	})
+}
+
 // GetKeyType returns the type of a given key in the hash.
 // If no key is found, it is considered to be a NULL.
 func (h *Hash) GetKeyType(k string) ObjectType {
@@ -433,11 +984,9 @@ func (h *Hash) Inspect() string {
 	var out bytes.Buffer
 
 	pairs := []string{}
-	for _, pair := range h.Pairs {
-		pairs = append(pairs, fmt.Sprintf(`%s: %s`, pair.Key.Json(), pair.Value.Json()))
+	for _, pair := range h.OrderedPairs() {
+		pairs = append(pairs, fmt.Sprintf(`%s: %s`, inspectElement(pair.Key), inspectElement(pair.Value)))
 	}
-	// create stable key ordered output
-	sort.Strings(pairs)
 
 	out.WriteString("{")
 	out.WriteString(strings.Join(pairs, ", "))
@@ -445,32 +994,23 @@ func (h *Hash) Inspect() string {
 
 	return out.String()
 }
-func (h *Hash) Json() string { return h.Inspect() }
 
-// Pretty convoluted logic here we could
-// refactor.
-// First we sort the hash keys alphabetically
-// and then we loop through them until
-// we reach the required position within
-// the loop.
-func (h *Hash) Next() (Object, Object) {
-	curPosition := 0
-	pairs := make(map[string]HashPair)
-	var keys []string
-	for _, v := range h.Pairs {
-		pairs[v.Key.Inspect()] = v
-		keys = append(keys, v.Key.Inspect())
-	}
-
-	sort.Strings(keys)
+// JSON only allows strings as keys, so
+// numbers, booleans and null are converted
+// to their string representation
+// ({1: "a"} becomes {"1": "a"}).
+func (h *Hash) Json() string { return EncodeJson(h, "", false) }
 
-	for _, k := range keys {
-		if h.Position == curPosition {
-			h.Position += 1
-			return pairs[k].Key, pairs[k].Value
-		}
+// Next returns the pair at the current position
+// of the hash, in insertion order, and moves the
+// cursor forward.
+func (h *Hash) Next() (Object, Object) {
+	keys := h.OrderedKeys()
 
-		curPosition += 1
+	if h.Position < len(keys) {
+		pair := h.Pairs[keys[h.Position]]
+		h.Position += 1
+		return pair.Key, pair.Value
 	}
 
 	return nil, nil
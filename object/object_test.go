@@ -1,6 +1,16 @@
 package object
 
-import "testing"
+import (
+	"math"
+	"math/big"
+	"os"
+	"os/signal"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/abs-lang/abs/token"
+)
 
 func TestStringHashKey(t *testing.T) {
 	hello1 := &String{Value: "Hello World"}
@@ -21,6 +31,97 @@ func TestStringHashKey(t *testing.T) {
 	}
 }
 
+func TestScalarHashKey(t *testing.T) {
+	tests := []struct {
+		a     Hashable
+		b     Hashable
+		equal bool
+	}{
+		{&Number{Value: 1}, &Number{Value: 1.0}, true},
+		{&Number{Value: 1}, &Number{Value: 1.5}, false},
+		{&Number{Value: 1}, &String{Value: "1"}, false},
+		{&Number{Big: new(big.Int).Lsh(big.NewInt(1), 60)}, &Number{Big: new(big.Int).Lsh(big.NewInt(1), 60)}, true},
+		{&Number{Big: new(big.Int).Lsh(big.NewInt(1), 60)}, &Number{Value: float64(1 << 60)}, true},
+		{&Boolean{Value: true}, TRUE, true},
+		{TRUE, FALSE, false},
+		{TRUE, &String{Value: "true"}, false},
+		{&Null{}, NULL, true},
+		{NULL, &String{Value: "null"}, false},
+	}
+
+	for _, tt := range tests {
+		if (tt.a.HashKey() == tt.b.HashKey()) != tt.equal {
+			t.Errorf("expected hash keys of %v and %v to be equal=%t", tt.a, tt.b, tt.equal)
+		}
+	}
+}
+
+func TestHashWithScalarKeys(t *testing.T) {
+	one := &Number{Value: 1}
+	h := &Hash{Pairs: map[HashKey]HashPair{
+		one.HashKey():  {one, &String{Value: "a"}},
+		TRUE.HashKey(): {TRUE, NULL},
+	}}
+
+	if h.Inspect() != `{1: "a", true: null}` {
+		t.Errorf("wrong Inspect() output: %s", h.Inspect())
+	}
+
+	if h.Json() != `{"1": "a", "true": null}` {
+		t.Errorf("wrong Json() output: %s", h.Json())
+	}
+}
+
+func TestNewHashFromPairs(t *testing.T) {
+	h := NewHashFromPairs(token.Token{}, []HashPair{
+		{Key: &String{Value: "b"}, Value: TRUE},
+		{Key: &Number{Value: 1}, Value: NULL},
+		{Key: &String{Value: "a"}, Value: FALSE},
+	})
+
+	if h.Inspect() != `{"b": true, 1: null, "a": false}` {
+		t.Errorf("wrong Inspect() output: %s", h.Inspect())
+	}
+}
+
+func TestHashInsertionOrder(t *testing.T) {
+	h := &Hash{}
+	for _, k := range []string{"c", "a", "b"} {
+		key := &String{Value: k}
+		h.Set(key.HashKey(), HashPair{key, NULL})
+	}
+
+	a := &String{Value: "a"}
+	h.Set(a.HashKey(), HashPair{a, TRUE})
+
+	if h.Inspect() != `{"c": null, "a": true, "b": null}` {
+		t.Errorf("wrong Inspect() output: %s", h.Inspect())
+	}
+
+	h.Delete(a.HashKey())
+	h.Set(a.HashKey(), HashPair{a, FALSE})
+
+	keys := ""
+	for k, _ := h.Next(); k != nil; k, _ = h.Next() {
+		keys += k.Inspect()
+	}
+
+	if keys != "cba" {
+		t.Errorf("wrong iteration order: %s", keys)
+	}
+
+	// pairs added without going through Set are
+	// appended, sorted, at the end of the hash
+	d := &String{Value: "d"}
+	e := &String{Value: "e"}
+	h.Pairs[e.HashKey()] = HashPair{e, NULL}
+	h.Pairs[d.HashKey()] = HashPair{d, NULL}
+
+	if h.Json() != `{"c": null, "b": null, "a": false, "d": null, "e": null}` {
+		t.Errorf("wrong Json() output: %s", h.Json())
+	}
+}
+
 func TestGenerateEqualityString(t *testing.T) {
 	tests := []struct {
 		input    Object
@@ -42,3 +143,177 @@ func TestGenerateEqualityString(t *testing.T) {
 		}
 	}
 }
+
+func TestErrorTraceback(t *testing.T) {
+	err := &Error{
+		Message: "cannot divide by zero",
+		Stack: []Frame{
+			{Function: "divide", File: "lib.abs", Line: 2, Column: 5, Code: "    throw \"cannot divide by zero\""},
+			{Function: "<main>", Line: 5, Column: 1, Code: "divide(1, 0)"},
+		},
+	}
+
+	expected := "Traceback (most recent call last):\n\t[5:1] in <main>\n\t\tdivide(1, 0)\n\tlib.abs:[2:5] in divide\n\t\tthrow \"cannot divide by zero\"\nERROR: cannot divide by zero"
+
+	if err.Traceback() != expected {
+		t.Fatalf("expected '%v', got '%v'", expected, err.Traceback())
+	}
+}
+
+func TestNewBigNumber(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		big      bool
+	}{
+		{"9007199254740992", "9007199254740992", false},
+		{"-9007199254740992", "-9007199254740992", false},
+		{"9007199254740993", "9007199254740993", true},
+		{"-9007199254740993", "-9007199254740993", true},
+		{"123456789012345678901234567890", "123456789012345678901234567890", true},
+	}
+
+	for _, tt := range tests {
+		i, _ := new(big.Int).SetString(tt.input, 10)
+		n := NewBigNumber(token.Token{}, i)
+
+		if n.Inspect() != tt.expected {
+			t.Errorf("expected '%v', got '%v'", tt.expected, n.Inspect())
+		}
+
+		if (n.Big != nil) != tt.big {
+			t.Errorf("expected %s to be big: %t", tt.input, tt.big)
+		}
+
+		if !n.IsInt() {
+			t.Errorf("expected %s to be an integer", tt.input)
+		}
+	}
+}
+
+func TestEncodeJson(t *testing.T) {
+	tests := []struct {
+		input    Object
+		expected string
+	}{
+		{&String{Value: "a\"b\\c\n\x01\x1f/è"}, `"a\"b\\c\n\u0001\u001f/è"`},
+		{&String{Value: "\xff"}, "\"�\""},
+		{&Number{Value: math.NaN()}, `null`},
+		{&Number{Value: math.Inf(-1)}, `null`},
+		{&Array{Elements: []Object{&Number{Value: math.Inf(1)}, &String{Value: "\t"}}}, `[null, "\t"]`},
+		{&ReturnValue{Value: TRUE}, `true`},
+		{&Error{Message: "oops", Kind: TYPE_ERROR, Line: 1, Column: 2}, `{"message": "oops", "kind": "TypeError", "file": "", "line": 1, "column": 2}`},
+		{NewHashFromPairs(token.Token{}, []HashPair{
+			{Key: &Number{Value: 1}, Value: &String{Value: "a"}},
+			{Key: &String{Value: "b"}, Value: TRUE},
+			{Key: &String{Value: "1"}, Value: &String{Value: "b"}},
+		}), `{"1": "b", "b": true}`},
+	}
+
+	for _, tt := range tests {
+		if tt.input.Json() != tt.expected {
+			t.Errorf("wrong JSON for %T. got=%s, want=%s", tt.input, tt.input.Json(), tt.expected)
+		}
+	}
+}
+
+func TestDecodeJson(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"😀"`, "😀"},
+		{`"\ud83d"`, "�"},
+		{`"\ud83dA"`, "�A"},
+		{`"è\/"`, "è/"},
+		{"\"\xff\"", "�"},
+		{` {"b": [1, -2.5e-1, true, false, null], "a": {}} `, `{"b": [1, -0.25, true, false, null], "a": {}}`},
+		{`9007199254740993`, `9007199254740993`},
+	}
+
+	for _, tt := range tests {
+		o, err := DecodeJson(tt.input)
+		if err != nil {
+			t.Errorf("unexpected error decoding %s: %s", tt.input, err)
+			continue
+		}
+
+		if o.Inspect() != tt.expected {
+			t.Errorf("wrong value decoding %s. got=%s, want=%s", tt.input, o.Inspect(), tt.expected)
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{"", "unexpected end of input, expected a value at [1:1]"},
+		{"[\n  1,\n  2\n  3\n]", "unexpected character '3', expected ',' or ']' at [4:3]"},
+		{"\"a\tb\"", `invalid control character '\t' in string at [1:3]`},
+		{`{"é": x}`, "unexpected character 'x', expected a value at [1:7]"},
+		{`-`, "unexpected end of input, expected a digit at [1:2]"},
+		{`.5`, "unexpected character '.', expected a value at [1:1]"},
+	}
+
+	for _, tt := range errors {
+		_, err := DecodeJson(tt.input)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error decoding %q. got=%v, want=%s", tt.input, err, tt.expected)
+		}
+	}
+}
+
+func TestParseSignal(t *testing.T) {
+	tests := []struct {
+		name string
+		ok   bool
+	}{
+		{"KILL", true},
+		{"kill", true},
+		{"SIGKILL", true},
+		{"9", true},
+		{"FOO", false},
+		{"", false},
+		{"-1", false},
+	}
+
+	for _, tt := range tests {
+		sig, ok := ParseSignal(tt.name)
+
+		if ok != tt.ok {
+			t.Errorf("ParseSignal(%q): expected ok=%v, got %v", tt.name, tt.ok, ok)
+		}
+
+		if ok && sig != signals["KILL"] {
+			t.Errorf("ParseSignal(%q): expected KILL, got %v", tt.name, sig)
+		}
+	}
+}
+
+func TestOnSignalKeepsOtherListeners(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("signals cannot be sent to ourselves on windows")
+	}
+
+	sig, _ := ParseSignal("USR1")
+	other := make(chan os.Signal, 1)
+	signal.Notify(other, sig)
+	defer signal.Stop(other)
+
+	traps := NewTraps()
+	traps.OnSignal(sig, &Trap{Signal: "USR1"})
+	traps.OnSignal(sig, nil)
+
+	p, _ := os.FindProcess(os.Getpid())
+	p.Signal(sig)
+
+	select {
+	case <-other:
+	case <-time.After(time.Second):
+		t.Fatalf("removing a trap stopped others from receiving the signal")
+	}
+
+	if _, ok := traps.Received(); ok {
+		t.Errorf("expected the removed trap not to receive the signal")
+	}
+}
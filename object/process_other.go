@@ -0,0 +1,42 @@
+//go:build !unix
+
+package object
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// signals that can be sent to commands,
+// by name: other signals are not supported
+// on systems without unix signals.
+var signals = map[string]syscall.Signal{
+	"INT":  syscall.Signal(2),
+	"KILL": syscall.Signal(9),
+}
+
+// SetProcessGroup is a no-op on systems
+// without process groups.
+func SetProcessGroup(c *exec.Cmd) {}
+
+// signalProcess sends a signal to the command:
+// on systems without process groups its children
+// are left alone.
+func signalProcess(c *exec.Cmd, sig os.Signal) error {
+	switch sig {
+	case signals["INT"]:
+		sig = os.Interrupt
+	case signals["KILL"]:
+		sig = os.Kill
+	}
+
+	return c.Process.Signal(sig)
+}
+
+// killProcess kills the command: on systems
+// without process groups its children are
+// left running.
+func killProcess(c *exec.Cmd) error {
+	return c.Process.Kill()
+}
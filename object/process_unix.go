@@ -0,0 +1,60 @@
+//go:build unix
+
+package object
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// signals that can be sent to commands,
+// by name
+var signals = map[string]syscall.Signal{
+	"HUP":   syscall.SIGHUP,
+	"INT":   syscall.SIGINT,
+	"QUIT":  syscall.SIGQUIT,
+	"KILL":  syscall.SIGKILL,
+	"USR1":  syscall.SIGUSR1,
+	"USR2":  syscall.SIGUSR2,
+	"PIPE":  syscall.SIGPIPE,
+	"ALRM":  syscall.SIGALRM,
+	"TERM":  syscall.SIGTERM,
+	"CHLD":  syscall.SIGCHLD,
+	"CONT":  syscall.SIGCONT,
+	"STOP":  syscall.SIGSTOP,
+	"TSTP":  syscall.SIGTSTP,
+	"TTIN":  syscall.SIGTTIN,
+	"TTOU":  syscall.SIGTTOU,
+	"WINCH": syscall.SIGWINCH,
+}
+
+// SetProcessGroup makes the command the leader of
+// a new process group, so that the processes it
+// spawns can be signaled, or killed, along with it.
+func SetProcessGroup(c *exec.Cmd) {
+	if c.SysProcAttr == nil {
+		c.SysProcAttr = &syscall.SysProcAttr{}
+	}
+
+	c.SysProcAttr.Setpgid = true
+}
+
+// signalProcess sends a signal to the command and,
+// if it leads its own process group, to all of
+// its children.
+func signalProcess(c *exec.Cmd, sig os.Signal) error {
+	if c.SysProcAttr != nil && c.SysProcAttr.Setpgid {
+		if s, ok := sig.(syscall.Signal); ok {
+			return syscall.Kill(-c.Process.Pid, s)
+		}
+	}
+
+	return c.Process.Signal(sig)
+}
+
+// killProcess kills the command and, if it leads
+// its own process group, all of its children.
+func killProcess(c *exec.Cmd) error {
+	return signalProcess(c, os.Kill)
+}
@@ -0,0 +1,129 @@
+package object
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+
+	"github.com/abs-lang/abs/token"
+)
+
+// Trap is a function a script wants to run
+// when something happens, such as receiving
+// a signal or exiting
+type Trap struct {
+	// Where the trap was set, so that
+	// the function shows up in stack
+	// traces as called from there
+	Token   token.Token
+	Handler Object
+	// The signal the trap is set
+	// for, such as "INT"
+	Signal string
+	// Run instead of Handler, for traps
+	// set by the interpreter itself, such
+	// as removing temporary files
+	Fn func()
+}
+
+// Traps holds the functions a script wants
+// to run when it receives a signal, through
+// on_signal(...), or when it exits, through
+// at_exit(...).
+//
+// Since the evaluator can only run one thing
+// at a time, signals are not handled as they
+// arrive but rather queued, until the script
+// is ready to run their handlers.
+type Traps struct {
+	signals map[os.Signal]*Trap
+	// Each signal is received on its own
+	// channel, so that it can stop being
+	// trapped without affecting the others
+	received map[os.Signal]chan os.Signal
+	atExit   []*Trap
+	mux      sync.Mutex
+}
+
+// NewTraps creates an empty set of traps
+func NewTraps() *Traps {
+	return &Traps{}
+}
+
+// OnSignal sets the handler for the given signal,
+// replacing any previous one. A nil handler
+// restores the default behavior of the signal.
+func (t *Traps) OnSignal(sig os.Signal, trap *Trap) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	if trap == nil {
+		// Anyone else listening for the
+		// signal, such as http.serve(...),
+		// keeps receiving it
+		if received, ok := t.received[sig]; ok {
+			signal.Stop(received)
+		}
+
+		delete(t.signals, sig)
+		delete(t.received, sig)
+		return
+	}
+
+	if t.signals == nil {
+		t.signals = map[os.Signal]*Trap{}
+		t.received = map[os.Signal]chan os.Signal{}
+	}
+
+	if _, ok := t.received[sig]; !ok {
+		t.received[sig] = make(chan os.Signal, 16)
+		signal.Notify(t.received[sig], sig)
+	}
+
+	t.signals[sig] = trap
+}
+
+// Received returns the handler of a signal
+// received since the last call, if any,
+// without blocking.
+func (t *Traps) Received() (*Trap, bool) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	for sig, received := range t.received {
+		select {
+		case <-received:
+			return t.signals[sig], true
+		default:
+		}
+	}
+
+	return nil, false
+}
+
+// AtExit registers a function to be run
+// when the script exits
+func (t *Traps) AtExit(trap *Trap) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	t.atExit = append(t.atExit, trap)
+}
+
+// Exiting returns the functions to be run
+// as the script exits, most recently
+// registered first, just like defer. They
+// are handed over only once, so that they
+// can't be run twice.
+func (t *Traps) Exiting() []*Trap {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	traps := []*Trap{}
+	for i := len(t.atExit) - 1; i >= 0; i-- {
+		traps = append(traps, t.atExit[i])
+	}
+
+	t.atExit = nil
+	return traps
+}
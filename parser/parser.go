@@ -2,6 +2,8 @@ package parser
 
 import (
 	"fmt"
+	"math"
+	"math/big"
 	"strconv"
 	"strings"
 
@@ -27,6 +29,12 @@ const (
 	HIGHEST     // special preference for -x or +y
 )
 
+// maxExactInt is the largest integer a float64
+// can represent without losing precision (2^53).
+// It mirrors object.MaxExactInt, as the parser
+// shouldn't depend on the object package.
+const maxExactInt = 1 << 53
+
 var precedences = map[token.TokenType]int{
 	token.AND:           AND,
 	token.OR:            AND,
@@ -124,6 +132,8 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.CURRENT_ARGS, p.parseCurrentArgsLiteral)
 	p.registerPrefix(token.AT, p.parseDecorator)
 	p.registerPrefix(token.DEFER, p.parseDefer)
+	p.registerPrefix(token.TRY, p.parseTryExpression)
+	p.registerPrefix(token.MATCH, p.parseMatchExpression)
 
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
 	p.registerInfix(token.PLUS, p.parseInfixExpression)
@@ -233,10 +243,27 @@ func (p *Parser) ParseProgram() *ast.Program {
 }
 
 func (p *Parser) parseStatement() ast.Statement {
+	begin := p.curToken.Position
+	statement := p.parseStatementKind()
+
+	// The statement ends right before
+	// whatever token comes after it
+	if s, ok := statement.(ast.Spannable); ok {
+		s.SetSpan(begin, p.peekToken.Position)
+	}
+
+	return statement
+}
+
+func (p *Parser) parseStatementKind() ast.Statement {
 	if p.curToken.Type == token.RETURN {
 		return p.parseReturnStatement()
 	}
 
+	if p.curToken.Type == token.THROW {
+		return p.parseThrowStatement()
+	}
+
 	statement := p.parseAssignStatement()
 	if statement != nil {
 		return statement
@@ -378,6 +405,25 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	return stmt
 }
 
+// throw "something went wrong"
+func (p *Parser) parseThrowStatement() *ast.ThrowStatement {
+	stmt := &ast.ThrowStatement{Token: p.curToken}
+
+	if p.peekTokenIs(token.SEMICOLON) || p.peekTokenIs(token.RBRACE) || p.peekTokenIs(token.EOF) {
+		p.reportError("throw requires a value: throw \"something went wrong\"", p.curToken)
+		return stmt
+	}
+
+	p.nextToken()
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
 // (x * y) + z
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 	stmt := &ast.ExpressionStatement{Token: p.curToken}
@@ -464,6 +510,18 @@ func (p *Parser) ParseNumberLiteral() ast.Expression {
 
 	lit.Value = value
 
+	// Integers beyond 2^53 would lose precision as floats,
+	// so we keep their exact value around
+	if math.Abs(value) >= maxExactInt {
+		if i, ok := new(big.Int).SetString(number, 10); ok {
+			if abbr != 0 {
+				i.Mul(i, big.NewInt(int64(abbr)))
+			}
+
+			lit.Big = i
+		}
+	}
+
 	return lit
 }
 
@@ -784,6 +842,119 @@ func (p *Parser) parseForInExpression(initialExpression *ast.ForExpression) ast.
 	return expression
 }
 
+// try { x() } catch err { echo(err) } finally { cleanup() }
+func (p *Parser) parseTryExpression() ast.Expression {
+	expression := &ast.TryExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	expression.Block = p.parseBlockStatement()
+
+	// catch err {...} or simply catch {...}
+	if p.peekTokenIs(token.CATCH) {
+		p.nextToken()
+
+		if p.peekTokenIs(token.IDENT) {
+			p.nextToken()
+			expression.Identifier = p.curToken.Literal
+		}
+
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+
+		expression.Catch = p.parseBlockStatement()
+	}
+
+	if p.peekTokenIs(token.FINALLY) {
+		p.nextToken()
+
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+
+		expression.Finally = p.parseBlockStatement()
+	}
+
+	if expression.Catch == nil && expression.Finally == nil {
+		p.reportError("a try block must be followed by a catch or a finally block", expression.Token)
+		return nil
+	}
+
+	return expression
+}
+
+// match x { 1 => "one", [a, b] if a > b => a, _ => "other" }
+func (p *Parser) parseMatchExpression() ast.Expression {
+	expression := &ast.MatchExpression{Token: p.curToken}
+	p.nextToken()
+	expression.Value = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+		arm := p.parseMatchArm()
+
+		if arm == nil {
+			return nil
+		}
+
+		expression.Arms = append(expression.Arms, arm)
+
+		// Arms can optionally be separated by commas
+		if p.peekTokenIs(token.COMMA) {
+			p.nextToken()
+		}
+
+		if p.peekTokenIs(token.EOF) {
+			p.reportError("unterminated match expression, expected }", expression.Token)
+			return nil
+		}
+	}
+
+	p.nextToken()
+
+	return expression
+}
+
+// pattern => body
+// pattern if guard => body
+// pattern => { body }
+func (p *Parser) parseMatchArm() *ast.MatchArm {
+	arm := &ast.MatchArm{}
+	arm.Pattern = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.IF) {
+		p.nextToken()
+		p.nextToken()
+		arm.Guard = p.parseExpression(LOWEST)
+	}
+
+	if !p.expectPeek(token.ARROW) {
+		return nil
+	}
+
+	arm.Token = p.curToken
+	p.nextToken()
+
+	if p.curTokenIs(token.LBRACE) {
+		arm.Body = p.parseBlockStatement()
+		return arm
+	}
+
+	// A single expression is treated
+	// as a block with a single statement
+	body := &ast.ExpressionStatement{Token: p.curToken, Expression: p.parseExpression(LOWEST)}
+	arm.Body = &ast.BlockStatement{Token: arm.Token, Statements: []ast.Statement{body}}
+
+	return arm
+}
+
 // { x + 1 }
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{Token: p.curToken}
@@ -1051,6 +1222,7 @@ func (p *Parser) ParseHashLiteral() ast.Expression {
 		value := p.parseExpression(LOWEST)
 
 		hash.Pairs[key] = value
+		hash.Keys = append(hash.Keys, key)
 
 		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
 			return nil
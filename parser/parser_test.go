@@ -810,6 +810,212 @@ while (x > y) {
 	}
 }
 
+func TestTryExpression(t *testing.T) {
+	tests := []struct {
+		input      string
+		identifier string
+		catch      bool
+		finally    bool
+	}{
+		{`try { x } catch err { err }`, "err", true, false},
+		{`try { x } catch { y }`, "", true, false},
+		{`try { x } finally { y }`, "", false, true},
+		{`try { x } catch e { y } finally { z }`, "e", true, true},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain %d statements. got=%d\n", 1, len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+		}
+
+		exp, ok := stmt.Expression.(*ast.TryExpression)
+		if !ok {
+			t.Fatalf("stmt.Expression is not ast.TryExpression. got=%T", stmt.Expression)
+		}
+
+		if len(exp.Block.Statements) != 1 {
+			t.Errorf("try block is not 1 statements. got=%d\n", len(exp.Block.Statements))
+		}
+
+		if exp.Identifier != tt.identifier {
+			t.Errorf("wrong catch identifier. want=%q, got=%q", tt.identifier, exp.Identifier)
+		}
+
+		if (exp.Catch != nil) != tt.catch {
+			t.Errorf("wrong catch block for %s. want=%t", tt.input, tt.catch)
+		}
+
+		if (exp.Finally != nil) != tt.finally {
+			t.Errorf("wrong finally block for %s. want=%t", tt.input, tt.finally)
+		}
+	}
+}
+
+func TestTryExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		err   string
+	}{
+		{input: "try { x }", err: "a try block must be followed by a catch or a finally block"},
+		{input: "try { x } catch err", err: "expected next token to be IDENT, got EOF instead"},
+		{input: "throw", err: "throw requires a value"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 {
+			t.Errorf("no parsing error detected")
+			t.FailNow()
+		}
+
+		parseError := p.Errors()[0]
+		if !strings.HasPrefix(parseError, tt.err) {
+			t.Errorf("wrong parser error detected: want '%s', got '%s'", tt.err, parseError)
+		}
+	}
+}
+
+func TestThrowStatement(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedValue interface{}
+	}{
+		{`throw "error"`, "error"},
+		{`throw err;`, "err"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statements. got=%d", len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.ThrowStatement)
+		if !ok {
+			t.Fatalf("stmt not *ast.ThrowStatement. got=%T", program.Statements[0])
+		}
+
+		if stmt.TokenLiteral() != "throw" {
+			t.Fatalf("stmt.TokenLiteral not 'throw', got %q", stmt.TokenLiteral())
+		}
+
+		switch expected := tt.expectedValue.(type) {
+		case string:
+			if stmt.Value.String() != expected {
+				t.Errorf("wrong thrown value. want=%q, got=%q", expected, stmt.Value.String())
+			}
+		}
+	}
+}
+
+func TestMatchExpression(t *testing.T) {
+	input := `match x { 1 => "one", [a, b] if a > b => a, {"a": a} => { a }, 1..10 => "range" _ => "other" }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n", 1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+
+	exp, ok := stmt.Expression.(*ast.MatchExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.MatchExpression. got=%T", stmt.Expression)
+	}
+
+	if !testIdentifier(t, exp.Value, "x") {
+		return
+	}
+
+	tests := []struct {
+		pattern string
+		guard   string
+		body    string
+	}{
+		{"1", "", "one"},
+		{"[a, b]", "(a > b)", "a"},
+		{"{a:a}", "", "a"},
+		{"(1 .. 10)", "", "range"},
+		{"_", "", "other"},
+	}
+
+	if len(exp.Arms) != len(tests) {
+		t.Fatalf("wrong number of arms. want=%d, got=%d", len(tests), len(exp.Arms))
+	}
+
+	for i, tt := range tests {
+		arm := exp.Arms[i]
+
+		if arm.Pattern.String() != tt.pattern {
+			t.Errorf("wrong pattern for arm %d. want=%s, got=%s", i, tt.pattern, arm.Pattern.String())
+		}
+
+		guard := ""
+		if arm.Guard != nil {
+			guard = arm.Guard.String()
+		}
+
+		if guard != tt.guard {
+			t.Errorf("wrong guard for arm %d. want=%s, got=%s", i, tt.guard, guard)
+		}
+
+		if arm.Body.String() != tt.body {
+			t.Errorf("wrong body for arm %d. want=%s, got=%s", i, tt.body, arm.Body.String())
+		}
+	}
+}
+
+func TestMatchExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		err   string
+	}{
+		{input: "match x { 1 }", err: "expected next token to be NUMBER, got } instead"},
+		{input: "match x 1 => 2", err: "expected next token to be IDENT, got NUMBER instead"},
+		{input: "match x { 1 => 2", err: "unterminated match expression, expected }"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 {
+			t.Errorf("no parsing error detected")
+			t.FailNow()
+		}
+
+		parseError := p.Errors()[0]
+		if !strings.HasPrefix(parseError, tt.err) {
+			t.Errorf("wrong parser error detected: want '%s', got '%s'", tt.err, parseError)
+		}
+	}
+}
+
 func TestForExpression(t *testing.T) {
 	tests := []struct {
 		input string
@@ -1727,6 +1933,12 @@ func TestParsingHashLiteralsStringKeys(t *testing.T) {
 		expectedValue := expected[literal.String()]
 		testNumberLiteral(t, value, expectedValue)
 	}
+
+	for i, key := range []string{"one", "two", "three"} {
+		if hash.Keys[i].String() != key {
+			t.Errorf("hash.Keys[%d] is not %q. got=%q", i, key, hash.Keys[i].String())
+		}
+	}
 }
 
 func TestParsingHashLiteralsBooleanKeys(t *testing.T) {
@@ -7,7 +7,9 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
+	"github.com/abs-lang/abs/evaluator"
 	"github.com/abs-lang/abs/object"
 	"github.com/abs-lang/abs/runner"
 	"github.com/abs-lang/abs/terminal"
@@ -39,6 +41,99 @@ func getAbsInitFile(env *object.Environment) {
 	Run(string(code), env)
 }
 
+// How long background commands are given to
+// terminate once the script is over, before
+// being killed
+const jobsGracePeriod = time.Second
+
+// exit terminates the program, making sure
+// commands running in background don't
+// outlive it
+func exit(env *object.Environment, code int) {
+	cleanup(env)
+	os.Exit(code)
+}
+
+// cleanup runs the functions registered through
+// at_exit(...) and terminates the commands still
+// running in background
+func cleanup(env *object.Environment) {
+	evaluator.AtExit(env)
+	env.Jobs.Cleanup(jobsGracePeriod)
+}
+
+// parseFlags applies the flags meant for the
+// interpreter, such as abs --strict script.abs,
+// to the settings scripts are run with, and
+// returns the remaining arguments. Flags after
+// the script belong to the script itself.
+func parseFlags(args []string, settings *object.Settings) ([]string, error) {
+	i := 1
+
+	for ; i < len(args); i++ {
+		switch {
+		case args[i] == "--strict":
+			settings.Strict = true
+			continue
+		case args[i] == "--dry-run":
+			settings.DryRun = true
+			// Scripts run by this one should
+			// be run in dry-run mode too
+			os.Setenv("ABS_DRY_RUN", "1")
+			continue
+		case args[i] == "--trace":
+			settings.Trace = os.Stderr
+			continue
+		case strings.HasPrefix(args[i], "--trace="):
+			trace, err := openTrace(strings.TrimPrefix(args[i], "--trace="))
+			if err != nil {
+				return nil, err
+			}
+			settings.Trace = trace
+			continue
+		}
+
+		break
+	}
+
+	return append([]string{args[0]}, args[i:]...), nil
+}
+
+// envSettings returns the settings scripts are
+// run with when no flag is passed to the
+// interpreter, such as ABS_STRICT=1
+func envSettings() (*object.Settings, error) {
+	settings := &object.Settings{
+		Strict: util.IsTruthy(os.Getenv("ABS_STRICT")),
+		DryRun: util.IsTruthy(os.Getenv("ABS_DRY_RUN")),
+	}
+
+	if util.IsTruthy(os.Getenv("ABS_TRACE")) {
+		settings.Trace = os.Stderr
+	}
+
+	if path := os.Getenv("ABS_TRACE_FILE"); path != "" {
+		trace, err := openTrace(path)
+		if err != nil {
+			return nil, err
+		}
+		settings.Trace = trace
+	}
+
+	return settings, nil
+}
+
+// openTrace opens the file the trace of
+// the script should be written to
+func openTrace(path string) (*os.File, error) {
+	path, err := util.ExpandPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+}
+
 // Core of the REPL.
 //
 // This function takes code and evaluates
@@ -46,6 +141,11 @@ func getAbsInitFile(env *object.Environment) {
 func Run(code string, env *object.Environment) {
 	out, ok, parseErrors := runner.Run(code, env)
 
+	// The script called exit(...)
+	if e, isExit := out.(*object.ExitError); isExit {
+		exit(env, e.Code)
+	}
+
 	// let's check if this REPL is interactive
 	v, _ := env.Get("ABS_INTERACTIVE")
 	interactive := v == object.TRUE
@@ -54,18 +154,18 @@ func Run(code string, env *object.Environment) {
 		printParserErrors(parseErrors, env)
 
 		if !interactive {
-			os.Exit(99)
+			exit(env, 99)
 		}
 
 		return
 	}
 
 	if !ok {
-		fmt.Fprintf(env.Stdio.Stdout, "%s", out)
+		fmt.Fprintf(env.Stdio.Stdout, "%s", formatError(out))
 		fmt.Fprintln(env.Stdio.Stdout)
 
 		if !interactive {
-			os.Exit(99)
+			exit(env, 99)
 		}
 		return
 	}
@@ -76,6 +176,17 @@ func Run(code string, env *object.Environment) {
 	}
 }
 
+// formatError returns the message of an uncaught error.
+// When the error was raised within a function (or a sourced
+// file) we print the full stack of calls that led to it.
+func formatError(out object.Object) string {
+	if err, ok := out.(*object.Error); ok && len(err.Stack) > 1 {
+		return err.Traceback()
+	}
+
+	return out.Inspect()
+}
+
 func printParserErrors(errors []string, env *object.Environment) {
 	fmt.Fprintf(env.Stdio.Stdout, "%s", " parser errors:\n")
 	for _, msg := range errors {
@@ -88,6 +199,18 @@ func printParserErrors(errors []string, env *object.Environment) {
 // load the builtin Fns names for the use of command completion, and
 // load the ABS_INIT_FILE into the global env
 func BeginRepl(args []string, version string) {
+	settings, err := envSettings()
+	if err == nil {
+		args, err = parseFlags(args, settings)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stdout, "Unable to open the trace file: %s\n", err.Error())
+		os.Exit(99)
+	}
+	// Scripts should not see the flags
+	// meant for the interpreter
+	os.Args = args
+
 	d, _ := os.Getwd()
 	interactive := true
 
@@ -97,6 +220,11 @@ func BeginRepl(args []string, version string) {
 	}
 
 	env := object.NewEnvironment(object.SystemStdio, d, version, interactive)
+	env.SetSettings(settings)
+
+	if !interactive {
+		env.File = args[1]
+	}
 
 	// get abs init file
 	// user may test ABS_INTERACTIVE to decide what code to run
@@ -116,11 +244,12 @@ func BeginRepl(args []string, version string) {
 			w,
 		)
 
-		if _, err := term.Run(); err != nil {
+		m, err := term.Run()
+		if err != nil {
 			log.Fatal(err)
 		}
 
-		return
+		exit(env, m.(terminal.Model).ExitCode())
 	}
 
 	// this is a script
@@ -132,4 +261,5 @@ func BeginRepl(args []string, version string) {
 	}
 
 	Run(string(code), env)
+	cleanup(env)
 }
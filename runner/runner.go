@@ -32,5 +32,9 @@ func Run(code string, env *object.Environment) (out object.Object, ok bool, pars
 		return object.NULL, false, []string{}
 	}
 
-	return evaluated, evaluated.Type() != object.ERROR_OBJ, parseErrors
+	// Errors that have been caught within the
+	// program are regular values, not failures
+	err, isErr := evaluated.(*object.Error)
+
+	return evaluated, !isErr || err.Caught, parseErrors
 }
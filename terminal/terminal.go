@@ -107,6 +107,15 @@ type Model struct {
 	// reverse search input
 	searchText     textinput.Model
 	searchPosition int
+	// the code the REPL should exit
+	// with, set through exit(...)
+	exitCode int
+}
+
+// ExitCode returns the code the REPL
+// should exit with
+func (m Model) ExitCode() int {
+	return m.exitCode
 }
 
 func (m Model) Init() tea.Cmd {
@@ -533,6 +542,14 @@ func (m Model) onDoneEval(res doneEval) (Model, tea.Cmd) {
 		lines.Add(strings.TrimSuffix(string(b), "\n"))
 	}
 
+	// exit(...) was called
+	if e, ok := res.out.(*object.ExitError); ok {
+		m.exitCode = e.Code
+		m, quit := m.quit()
+
+		return m, tea.Sequence(lines.Dump(), quit)
+	}
+
 	if res.out != object.NULL {
 		out := res.out.Inspect()
 
@@ -728,7 +745,7 @@ func (m Model) getSuggestions(n ast.Node) ([]Suggestion, string) {
 			break
 		}
 
-		for p := range hash.Pairs {
+		for _, p := range hash.OrderedKeys() {
 			matches = append(matches, NewSuggestion(p.Value, SUGGESTION_PROPERTY, hash.Pairs[p].Value.Inspect()))
 		}
 	}
@@ -59,6 +59,7 @@ const (
 	COMMA     = ","
 	SEMICOLON = ";"
 	COLON     = ":"
+	ARROW     = "=>"
 
 	LPAREN   = "("
 	RPAREN   = ")"
@@ -84,6 +85,11 @@ const (
 	BREAK    = "BREAK"
 	CONTINUE = "CONTINUE"
 	DEFER    = "DEFER"
+	TRY      = "TRY"
+	CATCH    = "CATCH"
+	FINALLY  = "FINALLY"
+	THROW    = "THROW"
+	MATCH    = "MATCH"
 )
 
 type Token struct {
@@ -106,6 +112,11 @@ var keywords = map[string]TokenType{
 	"break":    BREAK,
 	"continue": CONTINUE,
 	"defer":    DEFER,
+	"try":      TRY,
+	"catch":    CATCH,
+	"finally":  FINALLY,
+	"throw":    THROW,
+	"match":    MATCH,
 }
 
 // NumberAbbreviations is a list of abbreviations that can be used in numbers eg. 1k, 20B
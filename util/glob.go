@@ -0,0 +1,115 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Glob returns the paths matching the pattern, sorted.
+// Besides the patterns supported by filepath.Match,
+// such as *.go, a ** matches any number of
+// directories, including none: src/**/*.go matches
+// both src/main.go and src/lib/util/strings.go.
+//
+// Symbolic links to directories are not followed
+// by **, so that we don't get stuck in cycles.
+func Glob(pattern string) ([]string, error) {
+	// Let's validate the pattern upfront, else
+	// errors would depend on which directories
+	// we happen to look into
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+
+	pattern = filepath.Clean(pattern)
+	root := ""
+	if filepath.IsAbs(pattern) {
+		root = filepath.VolumeName(pattern) + string(filepath.Separator)
+		pattern = strings.TrimPrefix(pattern[len(root)-1:], string(filepath.Separator))
+	}
+
+	matches := map[string]bool{}
+	globParts(root, strings.Split(pattern, string(filepath.Separator)), matches)
+
+	paths := []string{}
+	for path := range matches {
+		paths = append(paths, path)
+	}
+
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// Matches the remaining parts of a pattern against
+// the entries of dir, recording the paths that
+// match all of them.
+func globParts(dir string, parts []string, matches map[string]bool) {
+	if len(parts) == 0 {
+		if dir != "" {
+			matches[dir] = true
+		}
+
+		return
+	}
+
+	part := parts[0]
+
+	// Parts without wildcards don't need
+	// to be matched against every entry
+	if !strings.ContainsAny(part, `*?[\`) {
+		path := globJoin(dir, part)
+
+		if _, err := os.Lstat(path); err == nil {
+			globParts(path, parts[1:], matches)
+		}
+
+		return
+	}
+
+	entries, err := os.ReadDir(globJoin(dir, "."))
+	if err != nil {
+		return
+	}
+
+	if part == "**" {
+		// ** can match no directory at all...
+		globParts(dir, parts[1:], matches)
+
+		// ...or any number of them. A trailing **
+		// matches files too, such as src/**
+		for _, entry := range entries {
+			switch {
+			case entry.IsDir():
+				globParts(globJoin(dir, entry.Name()), parts, matches)
+			case len(parts) == 1:
+				matches[globJoin(dir, entry.Name())] = true
+			}
+		}
+
+		return
+	}
+
+	for _, entry := range entries {
+		if ok, _ := filepath.Match(part, entry.Name()); !ok {
+			continue
+		}
+
+		if len(parts) > 1 && !entry.IsDir() {
+			continue
+		}
+
+		globParts(globJoin(dir, entry.Name()), parts[1:], matches)
+	}
+}
+
+// Joins paths, keeping relative
+// patterns relative
+func globJoin(dir string, name string) string {
+	if dir == "" {
+		return name
+	}
+
+	return filepath.Join(dir, name)
+}
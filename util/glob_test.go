@@ -0,0 +1,62 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestGlob(t *testing.T) {
+	dir := t.TempDir()
+	for _, f := range []string{"a.go", "b.txt", "src/c.go", "src/lib/d.go", "src/lib/e.txt", "src/lib/deep/f.go"} {
+		os.MkdirAll(filepath.Join(dir, filepath.Dir(f)), 0755)
+		os.WriteFile(filepath.Join(dir, f), []byte(""), 0644)
+	}
+
+	cwd, _ := os.Getwd()
+	os.Chdir(dir)
+	defer os.Chdir(cwd)
+
+	tests := []struct {
+		pattern  string
+		expected []string
+	}{
+		{"*.go", []string{"a.go"}},
+		{"src/*.go", []string{"src/c.go"}},
+		{"**/*.go", []string{"a.go", "src/c.go", "src/lib/d.go", "src/lib/deep/f.go"}},
+		{"src/**/*.go", []string{"src/c.go", "src/lib/d.go", "src/lib/deep/f.go"}},
+		{"src/**/*.txt", []string{"src/lib/e.txt"}},
+		{"src/**/deep", []string{"src/lib/deep"}},
+		{"src/lib/**", []string{"src/lib", "src/lib/d.go", "src/lib/deep", "src/lib/deep/f.go", "src/lib/e.txt"}},
+		{"**/**/f.go", []string{"src/lib/deep/f.go"}},
+		{"src/?.go", []string{"src/c.go"}},
+		{"src/[a-c].go", []string{"src/c.go"}},
+		{"*/lib/*.go", []string{"src/lib/d.go"}},
+		{"b.txt", []string{"b.txt"}},
+		{"nope/**/*.go", []string{}},
+		{"./src/*.go", []string{"src/c.go"}},
+		{filepath.Join(dir, "src", "*.go"), []string{filepath.Join(dir, "src", "c.go")}},
+	}
+
+	for _, tt := range tests {
+		paths, err := Glob(tt.pattern)
+		if err != nil {
+			t.Errorf("unexpected error for %s: %s", tt.pattern, err)
+			continue
+		}
+
+		expected := []string{}
+		for _, p := range tt.expected {
+			expected = append(expected, filepath.FromSlash(p))
+		}
+
+		if !reflect.DeepEqual(paths, expected) {
+			t.Errorf("wrong matches for %s. expected=%v, got=%v", tt.pattern, expected, paths)
+		}
+	}
+
+	if _, err := Glob("src/[.go"); err == nil {
+		t.Errorf("expected an error for a malformed pattern")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"os/user"
 	"path/filepath"
 	"regexp"
+	"runtime"
 	"strconv"
 	"strings"
 
@@ -106,6 +107,163 @@ func InterpolateStringVars(str string, env *object.Environment) string {
 	return str
 }
 
+var commandVar = regexp.MustCompile(`^\$(!)?(\{)?([a-zA-Z_0-9]+)(\})?`)
+
+// InterpolateCommandVars (str, env)
+// return the command with $vars interpolated from environment.
+// Unlike InterpolateStringVars, values are quoted so that the shell
+// treats them literally: $var and ${var} are quoted according to
+// where they appear in the command (outside or inside quotes), arrays
+// are expanded into one word per element, while $!{var} splices the
+// value as it is.
+func InterpolateCommandVars(str string, env *object.Environment) string {
+	var out strings.Builder
+	// the quote we're currently within, if any
+	var quote byte
+	windows := runtime.GOOS == "windows"
+
+	for i := 0; i < len(str); i++ {
+		c := str[i]
+
+		switch {
+		case c == '\\' && i+1 < len(str) && commandVar.MatchString(str[i+1:]):
+			// \$VAR becomes $VAR
+			continue
+		case c == '\\' && quote != '\'' && i+1 < len(str):
+			// escaped characters, such as \", don't
+			// open or close quotes
+			out.WriteByte(c)
+			out.WriteByte(str[i+1])
+			i++
+			continue
+		case (c == '\'' && !windows) || c == '"':
+			if quote == 0 {
+				quote = c
+			} else if quote == c {
+				quote = 0
+			}
+		case c == '$':
+			m := commandVar.FindStringSubmatch(str[i:])
+
+			// $!var is not supported, only $!{var}
+			if m == nil || (m[1] != "" && m[2] == "") {
+				break
+			}
+
+			// If the previous character is a backslash,
+			// this is an escaped variable
+			if i > 0 && str[i-1] == '\\' {
+				out.WriteString(m[0])
+				i += len(m[0]) - 1
+				continue
+			}
+
+			// If you type a variable wrong, forgetting the
+			// closing bracket, we simply return it to you:
+			// eg "my ${variable"
+			if m[2] != "" && m[4] == "" {
+				out.WriteString(m[0])
+				i += len(m[0]) - 1
+				continue
+			}
+
+			// "$var}" should not swallow the bracket
+			if m[2] == "" && m[4] != "" {
+				m[0] = m[0][:len(m[0])-1]
+			}
+
+			i += len(m[0]) - 1
+			v, ok := env.Get(m[3])
+
+			// If the variable is not found, we
+			// just dump an empty string
+			if !ok {
+				continue
+			}
+
+			words := []string{v.Inspect()}
+			if arr, ok := v.(*object.Array); ok {
+				words = []string{}
+				for _, e := range arr.Elements {
+					words = append(words, e.Inspect())
+				}
+			}
+
+			switch {
+			case m[1] != "":
+				out.WriteString(strings.Join(words, " "))
+			case quote == '"':
+				out.WriteString(shellEscapeDoubleQuoted(strings.Join(words, " ")))
+			case quote == '\'':
+				out.WriteString(strings.ReplaceAll(strings.Join(words, " "), "'", `'\''`))
+			default:
+				for j, w := range words {
+					if j > 0 {
+						out.WriteByte(' ')
+					}
+					out.WriteString(ShellQuote(w))
+				}
+			}
+
+			continue
+		}
+
+		out.WriteByte(c)
+	}
+
+	return out.String()
+}
+
+var safeShellWord = regexp.MustCompile(`^[a-zA-Z0-9_@%+=:,./-]+$`)
+
+// ShellQuote (str)
+// return str quoted so that the shell treats it as
+// a single, literal, word: "a b" becomes 'a b'.
+// Strings that don't need to be quoted are
+// returned as they are.
+func ShellQuote(str string) string {
+	if safeShellWord.MatchString(str) {
+		return str
+	}
+
+	if runtime.GOOS == "windows" {
+		return `"` + strings.ReplaceAll(str, `"`, `""`) + `"`
+	}
+
+	return "'" + strings.ReplaceAll(str, "'", `'\''`) + "'"
+}
+
+// shellEscapeDoubleQuoted escapes the characters that
+// have a special meaning within double quotes.
+func shellEscapeDoubleQuoted(str string) string {
+	if runtime.GOOS == "windows" {
+		return strings.ReplaceAll(str, `"`, `""`)
+	}
+
+	var out strings.Builder
+	for _, r := range str {
+		switch r {
+		case '"', '\\', '$', '`':
+			out.WriteRune('\\')
+		}
+		out.WriteRune(r)
+	}
+
+	return out.String()
+}
+
+// IsTruthy tells whether the value of an environment
+// variable turns a setting on: anything but an empty
+// string, "0" or "false" does.
+func IsTruthy(value string) bool {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "0", "false":
+		return false
+	}
+
+	return true
+}
+
 // UniqueStrings takes an input list of strings
 // and returns a version without duplicate values
 func UniqueStrings(slice []string) []string {
@@ -2,6 +2,7 @@ package util
 
 import (
 	"os"
+	"runtime"
 	"testing"
 
 	"github.com/abs-lang/abs/object"
@@ -79,6 +80,27 @@ func TestIsNumber(t *testing.T) {
 	}
 }
 
+func TestIsTruthy(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected bool
+	}{
+		{"1", true},
+		{"true", true},
+		{"yes", true},
+		{"", false},
+		{"0", false},
+		{"false", false},
+		{" FALSE ", false},
+	}
+
+	for _, tt := range tests {
+		if tt.expected != IsTruthy(tt.value) {
+			t.Fatalf("expected %v (%q)", tt.expected, tt.value)
+		}
+	}
+}
+
 func TestInterpolateStringVars(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -110,6 +132,60 @@ func TestInterpolateStringVars(t *testing.T) {
 	}
 }
 
+func TestInterpolateCommandVars(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("quoting on windows follows cmd.exe rules")
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"echo", "echo"},
+		{"echo $simple", "echo simple"},
+		{"echo $string", "echo 'a b; rm -rf x'"},
+		{"echo ${string}", "echo 'a b; rm -rf x'"},
+		{"echo $!{string}", "echo a b; rm -rf x"},
+		{"echo $!string", "echo $!string"},
+		{"echo $quote", `echo 'it'\''s'`},
+		{"echo \"$string\"", `echo "a b; rm -rf x"`},
+		{"echo \"$dollar\"", `echo "\$HOME \"\\\` + "`" + `"`},
+		{"echo '$quote'", `echo 'it'\''s'`},
+		{"echo \\'$string", `echo \''a b; rm -rf x'`},
+		{"echo $array", `echo a 'b c' 1`},
+		{"echo \"$array\"", `echo "a b c 1"`},
+		{"echo $!{array}", `echo a b c 1`},
+		{"echo $empty", `echo ''`},
+		{"echo $undefined", `echo `},
+		{"echo $number", `echo 1.5`},
+		{"echo \\$string", `echo $string`},
+		{"echo \\$0", `echo $0`},
+		{"echo $", `echo $`},
+		{"echo ${string x", `echo ${string x`},
+		{"echo $simple}", `echo simple}`},
+	}
+
+	env := object.NewEnvironment(object.SystemStdio, "", "dev", false)
+	env.Set("simple", &object.String{Value: "simple"})
+	env.Set("string", &object.String{Value: "a b; rm -rf x"})
+	env.Set("quote", &object.String{Value: "it's"})
+	env.Set("dollar", &object.String{Value: "$HOME \"\\`"})
+	env.Set("empty", &object.String{Value: ""})
+	env.Set("number", &object.Number{Value: 1.5})
+	env.Set("array", &object.Array{Elements: []object.Object{
+		&object.String{Value: "a"},
+		&object.String{Value: "b c"},
+		&object.Number{Value: 1},
+	}})
+
+	for _, tt := range tests {
+		output := InterpolateCommandVars(tt.input, env)
+		if tt.expected != output {
+			t.Errorf("expected '%v', got '%v' (original: %s)", tt.expected, output, tt.input)
+		}
+	}
+}
+
 func TestMapify(t *testing.T) {
 	elements := []object.Object{}
 	first := &object.String{Value: "x"}
@@ -0,0 +1,127 @@
+package util
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// WatchEvent is a change to a watched file,
+// such as it being created or written to
+type WatchEvent struct {
+	Path string
+	// One of create, write, remove or rename
+	Op   string
+	Time time.Time
+}
+
+// Watcher detects changes to files and directories
+// by periodically comparing them with how they looked
+// the last time we checked. This doesn't need any
+// support from the OS, and works the same way
+// everywhere.
+//
+// When a file is renamed, the watcher reports a rename
+// for its old path and a create for the new one.
+type Watcher struct {
+	paths     []string
+	recursive bool
+	files     map[string]os.FileInfo
+}
+
+// NewWatcher starts watching the given files or
+// directories. Directories are watched along with
+// their entries, and their subdirectories if
+// recursive.
+func NewWatcher(paths []string, recursive bool) *Watcher {
+	w := &Watcher{paths: paths, recursive: recursive}
+	w.files = w.snapshot()
+
+	return w
+}
+
+// Poll returns the changes since the last
+// poll, sorted by path.
+func (w *Watcher) Poll() []WatchEvent {
+	files := w.snapshot()
+	now := time.Now()
+	events := []WatchEvent{}
+	created := []string{}
+
+	for path, info := range files {
+		old, ok := w.files[path]
+
+		switch {
+		case !ok:
+			created = append(created, path)
+		case !info.IsDir() && (!info.ModTime().Equal(old.ModTime()) || info.Size() != old.Size()):
+			events = append(events, WatchEvent{Path: path, Op: "write", Time: now})
+		}
+	}
+
+	for path, old := range w.files {
+		if _, ok := files[path]; ok {
+			continue
+		}
+
+		op := "remove"
+		for _, c := range created {
+			if os.SameFile(old, files[c]) {
+				op = "rename"
+				break
+			}
+		}
+
+		events = append(events, WatchEvent{Path: path, Op: op, Time: now})
+	}
+
+	for _, path := range created {
+		events = append(events, WatchEvent{Path: path, Op: "create", Time: now})
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Path < events[j].Path
+	})
+
+	w.files = files
+	return events
+}
+
+// Records how the watched paths look right now.
+// Paths that don't exist are simply left out,
+// so that we notice once they're created.
+func (w *Watcher) snapshot() map[string]os.FileInfo {
+	files := map[string]os.FileInfo{}
+
+	for _, root := range w.paths {
+		info, err := os.Lstat(root)
+		if err != nil {
+			continue
+		}
+
+		files[root] = info
+		if !info.IsDir() {
+			continue
+		}
+
+		filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || path == root {
+				return nil
+			}
+
+			if info, err := d.Info(); err == nil {
+				files[path] = info
+			}
+
+			if d.IsDir() && !w.recursive {
+				return filepath.SkipDir
+			}
+
+			return nil
+		})
+	}
+
+	return files
+}
@@ -0,0 +1,62 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWatcher(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "a.txt")
+	nested := filepath.Join(dir, "sub", "b.txt")
+	os.Mkdir(filepath.Join(dir, "sub"), 0755)
+	os.WriteFile(file, []byte("a"), 0644)
+	os.WriteFile(nested, []byte("b"), 0644)
+
+	tests := []struct {
+		recursive bool
+		change    func()
+		expected  []string
+	}{
+		{false, func() {}, []string{}},
+		{false, func() { os.WriteFile(file, []byte("changed"), 0644) }, []string{"write " + file}},
+		{false, func() { os.WriteFile(filepath.Join(dir, "c.txt"), []byte("c"), 0644) }, []string{"create " + filepath.Join(dir, "c.txt")}},
+		{false, func() { os.Remove(filepath.Join(dir, "c.txt")) }, []string{"remove " + filepath.Join(dir, "c.txt")}},
+		{false, func() { os.Rename(file, filepath.Join(dir, "d.txt")) }, []string{"rename " + file, "create " + filepath.Join(dir, "d.txt")}},
+		{false, func() { os.WriteFile(nested, []byte("changed"), 0644) }, []string{}},
+		{true, func() { os.WriteFile(nested, []byte("changed again"), 0644) }, []string{"write " + nested}},
+	}
+
+	for i, tt := range tests {
+		w := NewWatcher([]string{dir}, tt.recursive)
+		tt.change()
+
+		events := []string{}
+		for _, e := range w.Poll() {
+			events = append(events, e.Op+" "+e.Path)
+		}
+
+		if !reflect.DeepEqual(events, tt.expected) {
+			t.Errorf("wrong events for change %d. expected=%v, got=%v", i, tt.expected, events)
+		}
+	}
+}
+
+func TestWatcherMissingPath(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "later.txt")
+	w := NewWatcher([]string{file}, false)
+
+	if events := w.Poll(); len(events) != 0 {
+		t.Errorf("expected no events, got %v", events)
+	}
+
+	os.WriteFile(file, []byte("now"), 0644)
+	events := w.Poll()
+
+	if len(events) != 1 || events[0].Op != "create" || events[0].Path != file || time.Since(events[0].Time) > time.Minute {
+		t.Errorf("expected %s to be created, got %v", file, events)
+	}
+}